@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"go-eink/eink"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runBridge shares local serial port over network, see -device tcp:// and rfc2217://
+func runBridge(args []string) {
+	flags := flag.NewFlagSet("bridge", flag.ExitOnError)
+	verbose := flags.Bool("verbose", false, "show extended output")
+	deviceName := flags.String("device", "", "serial device name, required, auto - find device by known USB VID/PID")
+	deviceProbe := flags.Bool("device-probe", false, "check that auto detected device can be opened, nothing is sent to device")
+	listen := flags.String("listen", "tcp://:7000", "network address, one of: tcp://host:port (raw TCP), rfc2217://host:port (RFC 2217)")
+	idleTimeout := flags.Int("idle-timeout", 300000, "disconnect client after no data in both directions (ms), 0 - never")
+	lockTimeout := flags.Int("lock-timeout", int(eink.DefaultLockTimeout/time.Millisecond), "wait for device used by another go-eink process when client connects (ms), 0 - fail immediately")
+	accessLogPath := flags.String("access-log", "", "write client connections to file instead of standard output")
+	flags.Parse(args)
+
+	setupLogger(*verbose)
+
+	address, rfc2217, ok := eink.ParseNetworkAddress(*listen)
+	if !ok {
+		log.Fatalf("unknown listen address: %s, use tcp://host:port or rfc2217://host:port", *listen)
+	}
+
+	if len(*deviceName) == 0 {
+		log.Fatal("device required")
+	}
+	if *deviceName == eink.DeviceAuto {
+		name, err := eink.FindDevice(context.Background(), *deviceProbe)
+		if err != nil {
+			log.Fatalf("unable to find device: %s", err)
+		}
+		log.Infof("found device: %s", name)
+		*deviceName = name
+	}
+
+	bridge := eink.NewBridge(eink.NewSerialTransport(*deviceName), rfc2217)
+	bridge.IdleTimeout = time.Duration(*idleTimeout) * time.Millisecond
+	bridge.LockTimeout = time.Duration(*lockTimeout) * time.Millisecond
+
+	if len(*accessLogPath) > 0 {
+		file, err := os.OpenFile(*accessLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("unable to open access log: %s", err)
+		}
+		defer file.Close()
+
+		accessLog := log.New()
+		accessLog.SetFormatter(&log.TextFormatter{
+			FullTimestamp: true,
+			DisableColors: true,
+		})
+		accessLog.SetOutput(file)
+		bridge.AccessLog = accessLog
+	}
+
+	log.Infof("bridge %s is listening on %s", *deviceName, *listen)
+
+	serveUntilSignal(bridge, address)
+}
+
+// serveUntilSignal runs bridge on address until interrupt
+func serveUntilSignal(bridge *eink.Bridge, address string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatalf("unable to listen: %s", err)
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		listener.Close()
+	}()
+
+	if err := bridge.Serve(listener); err != nil {
+		log.Fatalf("unable to accept connection: %s", err)
+	}
+}
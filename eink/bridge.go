@@ -0,0 +1,151 @@
+package eink
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Bridge exposes transport to network clients, one client at a time:
+// transport is opened on connection and closed on disconnection
+type Bridge struct {
+	Transport   Transport
+	RFC2217     bool
+	IdleTimeout time.Duration //disconnect client after no data in both directions, 0 - never
+	LockTimeout time.Duration //wait for device used by another process before serving client, 0 - fail immediately
+
+	Logger    log.FieldLogger
+	AccessLog log.FieldLogger //client connections and disconnections
+
+	mu     sync.Mutex
+	client net.Addr
+}
+
+func NewBridge(transport Transport, rfc2217 bool) *Bridge {
+	return &Bridge{
+		Transport:   transport,
+		RFC2217:     rfc2217,
+		LockTimeout: DefaultLockTimeout,
+		Logger:      log.StandardLogger(),
+		AccessLog:   log.StandardLogger(),
+	}
+}
+
+// Serve accepts connections until listener is closed, clients connected while transport is busy are rejected
+func (b *Bridge) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		if busy := b.acquire(conn.RemoteAddr()); busy != nil {
+			b.AccessLog.WithFields(log.Fields{"client": conn.RemoteAddr(), "busy": busy}).Warn("client rejected: device is busy")
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer b.release()
+			b.serve(conn)
+		}()
+	}
+}
+
+func (b *Bridge) serve(conn net.Conn) {
+	started := time.Now()
+	client := &bridgeConn{Conn: conn, idleTimeout: b.IdleTimeout}
+	defer client.Close()
+
+	b.AccessLog.WithField("client", conn.RemoteAddr()).Info("client connected")
+
+	setTransportLogger(b.Transport, b.Logger)
+
+	//device is locked for the whole session, so local prints do not interleave with client data
+	lock, err := lockDevice(context.Background(), b.Transport, b.LockTimeout)
+	if err != nil {
+		b.Logger.Errorf("unable to lock device: %s", err)
+	} else if err = b.Transport.Open(); err != nil {
+		lock.unlock()
+		b.Logger.Errorf("unable to open transport: %s", err)
+	} else {
+		defer lock.unlock()
+		client.touch()
+		err = ServeConn(client, b.Transport, b.RFC2217)
+	}
+
+	result := "closed"
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		result = "idle timeout"
+	} else if err != nil {
+		result = err.Error()
+	}
+
+	b.AccessLog.WithFields(log.Fields{
+		"client":    conn.RemoteAddr(),
+		"bytes_in":  client.bytesIn.Load(),
+		"bytes_out": client.bytesOut.Load(),
+		"duration":  time.Since(started).Round(time.Millisecond),
+		"result":    result,
+	}).Info("client disconnected")
+}
+
+// acquire takes single client lock, returns address of connected client if device is busy
+func (b *Bridge) acquire(client net.Addr) net.Addr {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		return b.client
+	}
+	b.client = client
+	return nil
+}
+
+func (b *Bridge) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.client = nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// bridgeConn counts traffic and extends read deadline on data in any direction
+type bridgeConn struct {
+	net.Conn
+	idleTimeout time.Duration
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+}
+
+func (c *bridgeConn) Read(buf []byte) (int, error) {
+	count, err := c.Conn.Read(buf)
+	c.bytesIn.Add(int64(count))
+	if count > 0 {
+		c.touch()
+	}
+	return count, err
+}
+
+func (c *bridgeConn) Write(data []byte) (int, error) {
+	count, err := c.Conn.Write(data)
+	c.bytesOut.Add(int64(count))
+	if count > 0 {
+		c.touch()
+	}
+	return count, err
+}
+
+func (c *bridgeConn) touch() {
+	if c.idleTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+}
@@ -0,0 +1,125 @@
+package eink
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// testBridge serves simulator on loopback address until test ends
+func testBridge(t *testing.T, idleTimeout time.Duration) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	logger := log.New()
+	logger.SetLevel(log.WarnLevel)
+
+	bridge := NewBridge(NewSimulator(DisplayProfiles[0]), false)
+	bridge.IdleTimeout = idleTimeout
+	bridge.Logger = logger
+	bridge.AccessLog = logger
+	go bridge.Serve(listener)
+
+	return listener.Addr().String()
+}
+
+// assertHandshake checks that client connection is served by simulator
+func assertHandshake(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	if _, err := conn.Write(handshakeRequest(ImageWidth, ImageHeight, DisplayModel, DeviceModeBW)); err != nil {
+		t.Fatalf("unable to send handshake: %s", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, 10)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		t.Fatalf("unable to read handshake response: %s", err)
+	}
+	if err := validateHandshakeResponse(response); err != nil {
+		t.Fatalf("invalid handshake response: %s", err)
+	}
+}
+
+// assertClosed checks that connection is closed by bridge within timeout
+func assertClosed(t *testing.T, conn net.Conn, timeout time.Duration) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("read error %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestBridgeSingleClient(t *testing.T) {
+	address := testBridge(t, 0)
+
+	first, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	assertHandshake(t, first)
+
+	second, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	assertClosed(t, second, time.Second)
+
+	//device is released when client disconnects
+	first.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		third, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = third.Write(handshakeRequest(ImageWidth, ImageHeight, DisplayModel, DeviceModeBW))
+		if err == nil {
+			third.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, err = io.ReadFull(third, make([]byte, 10))
+		}
+		third.Close()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("device is not released: %s", err)
+		}
+	}
+}
+
+func TestBridgeIdleTimeout(t *testing.T) {
+	address := testBridge(t, 100*time.Millisecond)
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	//traffic extends timeout, simulator takes data after handshake as frame
+	assertHandshake(t, conn)
+	for range 3 {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := conn.Write(make([]byte, 8)); err != nil {
+			t.Fatalf("connection is closed: %s", err)
+		}
+	}
+
+	started := time.Now()
+	assertClosed(t, conn, time.Second)
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("connection closed after %s of inactivity", elapsed)
+	}
+}
@@ -0,0 +1,143 @@
+package eink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	CaptureOpen  = "open"
+	CaptureClose = "close"
+	CaptureWrite = "write" //host to device
+	CaptureRead  = "read"  //device to host
+)
+
+// CaptureRecord is a single line of capture file (JSON lines)
+type CaptureRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"dir"`
+	Data      []byte    `json:"data,omitempty"`
+	Text      string    `json:"text,omitempty"` //printable Data for humans
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// RecordingTransport writes every byte passed through wrapped Transport to capture
+type RecordingTransport struct {
+	Transport
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewRecordingTransport(transport Transport, capture io.Writer) *RecordingTransport {
+	return &RecordingTransport{
+		Transport: transport,
+		encoder:   json.NewEncoder(capture),
+	}
+}
+
+func (t *RecordingTransport) Open() error {
+	if err := t.Transport.Open(); err != nil {
+		return err
+	}
+	t.record(CaptureOpen, nil)
+	return nil
+}
+
+func (t *RecordingTransport) Write(data []byte) (int, error) {
+	count, err := t.Transport.Write(data)
+	if count > 0 {
+		t.record(CaptureWrite, data[:count])
+	}
+	return count, err
+}
+
+func (t *RecordingTransport) Read(buf []byte) (int, error) {
+	count, err := t.Transport.Read(buf)
+	if count > 0 {
+		t.record(CaptureRead, buf[:count])
+	}
+	return count, err
+}
+
+func (t *RecordingTransport) Close() error {
+	t.record(CaptureClose, nil)
+	return t.Transport.Close()
+}
+
+func (t *RecordingTransport) record(direction string, data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	record := CaptureRecord{
+		Time:      time.Now(),
+		Direction: direction,
+		Data:      data,
+		Text:      printable(data),
+	}
+
+	//capture must not break printing
+	_ = t.encoder.Encode(record)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("unable to parse capture line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ReplayCapture opens transport and writes all data sent by host in capture,
+// data sent by device is discarded
+func ReplayCapture(records []CaptureRecord, transport Transport) error {
+	if err := transport.Open(); err != nil {
+		return err
+	}
+	defer transport.Close()
+
+	opened := false
+	for idx, record := range records {
+		switch record.Direction {
+		case CaptureOpen:
+			//reopen for every session but the first one
+			if opened {
+				transport.Close()
+				if err := transport.Open(); err != nil {
+					return err
+				}
+			}
+			opened = true
+		case CaptureWrite:
+			if err := writePortData(transport, record.Data); err != nil {
+				return fmt.Errorf("unable to replay record #%d: %w", idx, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package eink
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Phase string
+
+const (
+	PhaseOpen      Phase = "open"
+	PhaseHandshake Phase = "handshake"
+	PhaseUpload    Phase = "upload"
+	PhaseDrain     Phase = "drain"
+	PhaseRefresh   Phase = "refresh"
+)
+
+// InterruptedError is returned when device operation was aborted by context cancellation or deadline
+type InterruptedError struct {
+	Phase Phase
+	Err   error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("interrupted during %s: %s", e.Phase, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// interrupted replaces err with *InterruptedError when ctx is done,
+// as I/O errors are caused by closing transport in that case
+func interrupted(ctx context.Context, phase Phase, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return &InterruptedError{Phase: phase, Err: ctxErr}
+	}
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
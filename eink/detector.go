@@ -1,40 +1,170 @@
 package eink
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 	"go.bug.st/serial"
 	"go.bug.st/serial/enumerator"
 )
 
-func EnumerateDevices() {
+// probe results of DeviceInfo
+const (
+	ProbeOK     = "ok"     //port can be opened
+	ProbeBusy   = "busy"   //port is locked by another process, see ErrDeviceLocked
+	ProbeFailed = "failed" //port can not be opened
+)
+
+// DeviceInfo describes serial port, Probe is empty when port was not probed
+type DeviceInfo struct {
+	Name         string `json:"name"`
+	IsUSB        bool   `json:"usb"`
+	VID          string `json:"vid"`
+	PID          string `json:"pid"`
+	SerialNumber string `json:"serialNumber"`
+	Product      string `json:"product"`
+	Known        bool   `json:"known"`
+	Probe        string `json:"probe,omitempty"`
+}
+
+// EnumerateDevices returns names of all serial ports
+func EnumerateDevices() ([]string, error) {
 	ports, err := serial.GetPortsList()
 	if err != nil {
-		log.Errorf("unable to get serial ports list: %s", err)
-		return
-	}
-	if len(ports) == 0 {
-		log.Errorf("no serial ports found")
-		return
-	}
-	for _, port := range ports {
-		log.Infof("found serial port: %s", port)
+		return nil, fmt.Errorf("unable to get serial ports list: %w", err)
 	}
+	return ports, nil
 }
 
-func EnumerateDevicesExtended() {
+// EnumerateDevicesExtended returns USB serial ports details,
+// with probe ports with known USB VID/PID are also opened, see Printer.Probe
+func EnumerateDevicesExtended(ctx context.Context, probe bool) ([]DeviceInfo, error) {
 	ports, err := enumerator.GetDetailedPortsList()
 	if err != nil {
-		log.Errorf("unable to get detailed serial ports list: %s", err)
-		return
-	}
-	if len(ports) == 0 {
-		log.Fatalf("no serial ports found")
-		return
+		return nil, fmt.Errorf("unable to get detailed serial ports list: %w", err)
 	}
+
+	devices := []DeviceInfo{}
 	for _, port := range ports {
 		if !port.IsUSB {
 			continue
 		}
-		log.Infof("found serial port: name=\"%s\", vendorId=\"%s\", productId=\"%s\"", port.Name, port.VID, port.PID)
+
+		device := DeviceInfo{
+			Name:         port.Name,
+			IsUSB:        port.IsUSB,
+			VID:          port.VID,
+			PID:          port.PID,
+			SerialNumber: port.SerialNumber,
+			Product:      port.Product,
+			Known:        isKnownDevice(port.VID, port.PID),
+		}
+
+		if probe && device.Known {
+			device.Probe = probeDevice(ctx, port.Name)
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+const (
+	DeviceAuto = "auto"
+
+	probeTimeout = 5 * time.Second
+)
+
+var ErrNoDevice = errors.New("no display device found")
+
+type USBID struct {
+	VID  string
+	PID  string
+	Name string
+}
+
+// KnownDevices lists USB-serial chips used on display driver boards
+var KnownDevices = []USBID{
+	{VID: "1a86", PID: "7523", Name: "CH340"},
+	{VID: "1a86", PID: "5523", Name: "CH341"},
+	{VID: "1a86", PID: "55d4", Name: "CH9102"},
+}
+
+// AmbiguousDeviceError is returned by FindDevice when more than one device matches
+type AmbiguousDeviceError struct {
+	Candidates []string
+}
+
+func (e *AmbiguousDeviceError) Error() string {
+	return fmt.Sprintf("more than one display device found: %s", strings.Join(e.Candidates, ", "))
+}
+
+// FindDevice returns name of the only serial port with known USB VID/PID,
+// with probe candidates that can not be opened are skipped, busy ones are kept
+func FindDevice(ctx context.Context, probe bool) (string, error) {
+	devices, err := EnumerateDevicesExtended(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	for _, device := range devices {
+		if !device.Known {
+			continue
+		}
+
+		log.Debugf("candidate serial port: name=\"%s\", vendorId=\"%s\", productId=\"%s\"", device.Name, device.VID, device.PID)
+
+		if probe && probeDevice(ctx, device.Name) == ProbeFailed {
+			continue
+		}
+
+		candidates = append(candidates, device.Name)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", ErrNoDevice
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", &AmbiguousDeviceError{Candidates: candidates}
+	}
+}
+
+func isKnownDevice(vid, pid string) bool {
+	for _, device := range KnownDevices {
+		if strings.EqualFold(device.VID, vid) && strings.EqualFold(device.PID, pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeDevice opens port without waiting for lock held by another process and returns probe result
+func probeDevice(ctx context.Context, portName string) string {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	printer := NewPrinter(NewSerialTransport(portName))
+	printer.LockTimeout = 0
+
+	err := printer.Probe(ctx)
+	switch {
+	case err == nil:
+		return ProbeOK
+	case errors.Is(err, ErrDeviceLocked):
+		log.Debugf("serial port %s is busy: %s", portName, err)
+		return ProbeBusy
+	default:
+		log.Debugf("serial port %s can not be opened: %s", portName, err)
+		return ProbeFailed
 	}
 }
@@ -0,0 +1,159 @@
+package eink
+
+import (
+	"fmt"
+	"go-eink/images"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDisplay   = "7.5in"
+	DefaultChunkSize = 4096
+)
+
+// DisplayProfile describes panel connected to the driver board
+type DisplayProfile struct {
+	Name        string
+	Description string
+
+	Width  int
+	Height int
+	Model  byte     //display model byte sent in handshake, 0 - unknown, see ErrUnknownModel
+	Modes  []string //supported device modes
+
+	ChunkSize          int
+	WriteDataPause     time.Duration //recommended
+	ScreenRefreshPause time.Duration //recommended
+
+	Inks images.Palette //colors of inks on panel, zero - idealised colors
+}
+
+// DisplayProfiles is a registry of known panels, the first one is used by default.
+// Handshake encodes BW frame size in 16 bits, so panels larger than 524280 pixels
+// (e.g. 13.3 inch 960x680) can not be driven with this protocol.
+var DisplayProfiles = []*DisplayProfile{
+	{
+		Name:               DefaultDisplay,
+		Description:        "generic 7.5 inch 800x480 (IL075U, IL075RU, GDP075FU1)",
+		Width:              ImageWidth,
+		Height:             ImageHeight,
+		Model:              DisplayModel,
+		Modes:              []string{DeviceModeBW, DeviceModeBWR, DeviceModeBWRY},
+		ChunkSize:          DefaultChunkSize,
+		WriteDataPause:     DefaultWriteDataPause,
+		ScreenRefreshPause: DefaultScreenRefreshPause,
+	},
+	{
+		Name:               "il075u",
+		Description:        "GoodDisplay IL075U 7.5 inch 800x480, black and white",
+		Width:              ImageWidth,
+		Height:             ImageHeight,
+		Model:              DisplayModel,
+		Modes:              []string{DeviceModeBW},
+		ChunkSize:          DefaultChunkSize,
+		WriteDataPause:     DefaultWriteDataPause,
+		ScreenRefreshPause: DefaultScreenRefreshPause,
+	},
+	{
+		Name:               "il075ru",
+		Description:        "GoodDisplay IL075RU 7.5 inch 800x480, black, white and red",
+		Width:              ImageWidth,
+		Height:             ImageHeight,
+		Model:              DisplayModel,
+		Modes:              []string{DeviceModeBW, DeviceModeBWR},
+		ChunkSize:          DefaultChunkSize,
+		WriteDataPause:     DefaultWriteDataPause,
+		ScreenRefreshPause: DefaultScreenRefreshPause,
+	},
+	{
+		Name:               "gdp075fu1",
+		Description:        "GoodDisplay GDP075FU1 7.5 inch 800x480, black, white, red and yellow",
+		Width:              ImageWidth,
+		Height:             ImageHeight,
+		Model:              DisplayModel,
+		Modes:              []string{DeviceModeBWRY},
+		ChunkSize:          DefaultChunkSize,
+		WriteDataPause:     DefaultWriteDataPause,
+		ScreenRefreshPause: DefaultScreenRefreshPause,
+	},
+	{
+		Name:               "4.2in",
+		Description:        "4.2 inch 400x300 (model byte is not known, not tested on hardware)",
+		Width:              400,
+		Height:             300,
+		Modes:              []string{DeviceModeBW, DeviceModeBWR, DeviceModeBWRY},
+		ChunkSize:          DefaultChunkSize,
+		WriteDataPause:     DefaultWriteDataPause,
+		ScreenRefreshPause: DefaultScreenRefreshPause,
+	},
+	{
+		Name:               "5.83in",
+		Description:        "5.83 inch 648x480 (model byte is not known, not tested on hardware)",
+		Width:              648,
+		Height:             480,
+		Modes:              []string{DeviceModeBW, DeviceModeBWR, DeviceModeBWRY},
+		ChunkSize:          DefaultChunkSize,
+		WriteDataPause:     DefaultWriteDataPause,
+		ScreenRefreshPause: DefaultScreenRefreshPause,
+	},
+}
+
+func GetDisplayProfile(name string) (*DisplayProfile, error) {
+	for _, profile := range DisplayProfiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown display: %s", name)
+}
+
+func DisplayProfileNames() []string {
+	var names []string
+	for _, profile := range DisplayProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (d *DisplayProfile) SupportsMode(deviceMode string) bool {
+	for _, mode := range d.Modes {
+		if mode == deviceMode {
+			return true
+		}
+	}
+	return false
+}
+
+// BitsPerPixel returns packed image data density:
+// BW is 1 bit plane, BWR is 2 bit planes one after another, BWRY is 2 bits per pixel
+func (d *DisplayProfile) BitsPerPixel(deviceMode string) int {
+	switch deviceMode {
+	case DeviceModeBWR, DeviceModeBWRY:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// FrameSize returns expected image data length
+func (d *DisplayProfile) FrameSize(deviceMode string) int {
+	return d.Width * d.Height * d.BitsPerPixel(deviceMode) / 8
+}
+
+// InkPalette returns colors of inks on panel
+func (d *DisplayProfile) InkPalette() images.Palette {
+	if d.Inks == (images.Palette{}) {
+		return images.DefaultPalette
+	}
+	return d.Inks
+}
+
+func (d *DisplayProfile) chunkSize() int {
+	if d.ChunkSize <= 0 {
+		return DefaultChunkSize
+	}
+	return d.ChunkSize
+}
@@ -0,0 +1,104 @@
+package eink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrPortOpen           = errors.New("unable to open port")
+	ErrHandshakeLength    = errors.New("handshake response length mismatch")
+	ErrHandshakeMagic     = errors.New("handshake response magic mismatch")
+	ErrHandshakeChecksum  = errors.New("handshake response checksum mismatch")
+	ErrByteCountMismatch  = errors.New("received incorrect number of bytes from display")
+	ErrMalformedOutput    = errors.New("malformed device output")
+	ErrImageDataLength    = errors.New("image data length mismatch")
+	ErrUnknownDeviceMode  = errors.New("unknown device mode")
+	ErrUnknownFlowControl = errors.New("unknown flow control")
+	ErrUnknownModel       = errors.New("display model byte is unknown")
+	ErrUnsupportedMode    = errors.New("device mode is not supported by display")
+	ErrTimeout            = errors.New("device operation timed out")
+	ErrJobSuperseded      = errors.New("job superseded by newer job")
+	ErrQueueClosed        = errors.New("queue closed")
+	ErrDeviceLocked       = errors.New("device is used by another process")
+)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// PortError is returned when transport can not be opened, matches ErrPortOpen
+type PortError struct {
+	PortName string
+	Err      error
+}
+
+func (e *PortError) Error() string {
+	return fmt.Sprintf("unable to open port %s: %s", e.PortName, e.Err)
+}
+
+func (e *PortError) Unwrap() []error {
+	return []error{ErrPortOpen, e.Err}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// HandshakeError describes invalid handshake response,
+// Err is one of ErrHandshakeLength, ErrHandshakeMagic, ErrHandshakeChecksum
+type HandshakeError struct {
+	Err      error
+	Offset   int //byte offset, -1 for length mismatch
+	Expected int
+	Actual   int
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: expected %d bytes, got %d", e.Err, e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("%s: byte #%d expected 0x%02x, got 0x%02x", e.Err, e.Offset, e.Expected, e.Actual)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// ByteCountError is returned when display reports wrong number of received bytes, matches ErrByteCountMismatch
+type ByteCountError struct {
+	Expected int
+	Received int
+}
+
+func (e *ByteCountError) Error() string {
+	return fmt.Sprintf("%s: sent %d, received %d", ErrByteCountMismatch, e.Expected, e.Received)
+}
+
+func (e *ByteCountError) Unwrap() error {
+	return ErrByteCountMismatch
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// UnsupportedModeError is returned when display can not work in requested mode, matches ErrUnsupportedMode
+type UnsupportedModeError struct {
+	Display    string
+	DeviceMode string
+	Supported  []string
+}
+
+func (e *UnsupportedModeError) Error() string {
+	return fmt.Sprintf("display %s does not support device mode %s, supported modes: %s", e.Display, e.DeviceMode, strings.Join(e.Supported, ", "))
+}
+
+func (e *UnsupportedModeError) Unwrap() error {
+	return ErrUnsupportedMode
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Is makes InterruptedError caused by deadline match ErrTimeout
+func (e *InterruptedError) Is(target error) bool {
+	return target == ErrTimeout && errors.Is(e.Err, context.DeadlineExceeded)
+}
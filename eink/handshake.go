@@ -0,0 +1,47 @@
+package eink
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// HandshakeResponse is decoded reply of the board to handshake request.
+// Bytes 3..7 of response follow the layout of request:
+// frame size (2 bytes), BWRY mode, display model, BWR mode.
+type HandshakeResponse struct {
+	Raw       string `json:"raw"`     //hex
+	Payload   string `json:"payload"` //hex, bytes 3..7
+	FrameSize int    `json:"frameSize"`
+	Model     byte   `json:"model"`
+	ModeBWRY  byte   `json:"modeBwry"`
+	ModeBWR   byte   `json:"modeBwr"`
+	Mode      string `json:"mode"`
+	Echo      bool   `json:"echo"` //payload is equal to request
+}
+
+func parseHandshakeResponse(request, response []byte) *HandshakeResponse {
+	r := &HandshakeResponse{
+		Raw:       hex.EncodeToString(response),
+		Payload:   hex.EncodeToString(response[3:8]),
+		FrameSize: int(response[3])*256 + int(response[4]),
+		ModeBWRY:  response[5],
+		Model:     response[6],
+		ModeBWR:   response[7],
+		Mode:      DeviceModeBW,
+		Echo:      bytes.Equal(request[3:8], response[3:8]),
+	}
+
+	if r.ModeBWR == DisplayModeByteBWR {
+		r.Mode = DeviceModeBWR
+	}
+	if r.ModeBWRY == DisplayModeByteBWRY {
+		r.Mode = DeviceModeBWRY
+	}
+
+	return r
+}
+
+func (r *HandshakeResponse) String() string {
+	return fmt.Sprintf("frameSize=%d, model=0x%02x, mode=%s, echo=%t, raw=%s", r.FrameSize, r.Model, r.Mode, r.Echo, r.Raw)
+}
@@ -0,0 +1,81 @@
+package eink
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	for _, deviceMode := range []string{DeviceModeBW, DeviceModeBWR, DeviceModeBWRY} {
+		t.Run(deviceMode, func(t *testing.T) {
+			request := handshakeRequest(ImageWidth, ImageHeight, DisplayModel, deviceMode)
+			if err := validateHandshakeRequest(request); err != nil {
+				t.Fatalf("invalid request: %s", err)
+			}
+
+			response := handshakeResponse(request)
+			if err := validateHandshakeResponse(response); err != nil {
+				t.Fatalf("invalid response: %s", err)
+			}
+
+			parsed := parseHandshakeResponse(request, response)
+			if parsed.Mode != deviceMode {
+				t.Errorf("mode %s, expected %s", parsed.Mode, deviceMode)
+			}
+			if parsed.FrameSize != ImageWidth*ImageHeight/8 {
+				t.Errorf("frame size %d, expected %d", parsed.FrameSize, ImageWidth*ImageHeight/8)
+			}
+			if parsed.Model != DisplayModel || !parsed.Echo {
+				t.Errorf("model 0x%02x, echo %t", parsed.Model, parsed.Echo)
+			}
+		})
+	}
+}
+
+func TestHandshakeResponseErrors(t *testing.T) {
+	response := handshakeResponse(handshakeRequest(ImageWidth, ImageHeight, DisplayModel, DeviceModeBW))
+
+	corrupt := func(offset int) []byte {
+		corrupted := append([]byte{}, response...)
+		corrupted[offset]++
+		return corrupted
+	}
+
+	tests := []struct {
+		name     string
+		response []byte
+		expected error
+	}{
+		{"length", response[:9], ErrHandshakeLength},
+		{"magic", corrupt(2), ErrHandshakeMagic},
+		{"trailer", corrupt(9), ErrHandshakeMagic},
+		{"checksum", corrupt(8), ErrHandshakeChecksum},
+		{"payload", corrupt(4), ErrHandshakeChecksum},
+	}
+
+	for _, test := range tests {
+		if err := validateHandshakeResponse(test.response); !errors.Is(err, test.expected) {
+			t.Errorf("%s: error %v, expected %v", test.name, err, test.expected)
+		}
+	}
+}
+
+func TestPrinterOnHandshake(t *testing.T) {
+	display := DisplayProfiles[0]
+	printer := testPrinter(NewSimulator(display), display, DeviceModeBWR)
+
+	var response *HandshakeResponse
+	printer.OnHandshake = func(r *HandshakeResponse) {
+		response = r
+	}
+
+	if err := printer.Print(testImageData(display.FrameSize(DeviceModeBWR))); err != nil {
+		t.Fatalf("print failed: %s", err)
+	}
+	if response == nil {
+		t.Fatal("handshake response is not reported")
+	}
+	if response.Mode != DeviceModeBWR || response.Model != display.Model || !response.Echo {
+		t.Errorf("handshake response %s", response)
+	}
+}
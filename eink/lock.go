@@ -0,0 +1,111 @@
+package eink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLockTimeout = 60 * time.Second
+
+	lockRetryPause = 100 * time.Millisecond
+)
+
+// deviceLock is an advisory lock on a file named after the port, held by a single process at a time
+type deviceLock struct {
+	file *os.File
+}
+
+// lockDevice waits until lock for transport port is free, at most timeout, 0 - fail immediately.
+// Transports without port name (simulator) are not locked, nil lock is returned
+func lockDevice(ctx context.Context, transport Transport, timeout time.Duration) (*deviceLock, error) {
+	name := transportName(transport)
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	path := lockPath(name)
+	file, err := openLockFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file %s: %w", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("unable to lock %s: %w", path, err)
+		}
+		if locked {
+			return &deviceLock{file: file}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("%w: %s", ErrDeviceLocked, name)
+		}
+		pause := lockRetryPause
+		if left := time.Until(deadline); left < pause {
+			pause = left
+		}
+		if err := sleep(ctx, pause); err != nil {
+			file.Close()
+			return nil, &InterruptedError{Phase: PhaseOpen, Err: err}
+		}
+	}
+}
+
+// openLockFile opens lock file read-only, flock does not need write access:
+// file created by another user (e.g. root cron job) in shared temporary directory can not be opened for writing
+func openLockFile(path string) (*os.File, error) {
+	for {
+		file, err := os.Open(path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0666)
+		if !errors.Is(err, fs.ErrExist) {
+			return file, err
+		}
+	}
+}
+
+func (l *deviceLock) unlock() {
+	if l == nil {
+		return
+	}
+	unlockFile(l.file)
+	l.file.Close()
+}
+
+// lockPath returns lock file in temporary directory, /dev/ttyUSB0 - go-eink-dev-ttyUSB0.lock
+func lockPath(name string) string {
+	replacer := strings.NewReplacer("/", "-", "\\", "-", ":", "-")
+	name = strings.Trim(replacer.Replace(name), "-")
+	return filepath.Join(os.TempDir(), "go-eink-"+name+".lock")
+}
+
+// transportName identifies device for lock and state file,
+// symlinks of serial port (/dev/serial/by-id/...) are resolved, so aliases of one board share the lock
+func transportName(transport Transport) string {
+	switch t := transport.(type) {
+	case *SerialTransport:
+		if path, err := filepath.EvalSymlinks(t.PortName); err == nil {
+			return path
+		}
+		return t.PortName
+	case *NetworkTransport:
+		return t.Address
+	case *RecordingTransport:
+		return transportName(t.Transport)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package eink
+
+import "os"
+
+// tryLockFile always succeeds: serial ports are opened exclusively by the system
+func tryLockFile(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(file *os.File) {
+}
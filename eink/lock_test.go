@@ -0,0 +1,58 @@
+//go:build unix
+
+package eink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockDeviceSymlink(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	dir := t.TempDir()
+	port := filepath.Join(dir, "ttyUSB0")
+	alias := filepath.Join(dir, "usb-board-if00-port0")
+	if err := os.WriteFile(port, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(port, alias); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := lockDevice(context.Background(), NewSerialTransport(alias), 0)
+	if err != nil {
+		t.Fatalf("unable to lock: %s", err)
+	}
+
+	_, err = lockDevice(context.Background(), NewSerialTransport(port), 0)
+	if !errors.Is(err, ErrDeviceLocked) {
+		t.Fatalf("error %v, expected %v", err, ErrDeviceLocked)
+	}
+
+	lock.unlock()
+
+	lock, err = lockDevice(context.Background(), NewSerialTransport(port), 0)
+	if err != nil {
+		t.Fatalf("unable to lock after unlock: %s", err)
+	}
+	lock.unlock()
+}
+
+func TestLockDeviceReadOnlyFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	transport := NewSerialTransport("/dev/ttyTEST0")
+	if err := os.WriteFile(lockPath(transportName(transport)), nil, 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := lockDevice(context.Background(), transport, 0)
+	if err != nil {
+		t.Fatalf("unable to lock: %s", err)
+	}
+	lock.unlock()
+}
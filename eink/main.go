@@ -1,6 +1,8 @@
 package eink
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -18,7 +20,7 @@ const (
 	CR = 0x0d
 	LF = 0x0a
 
-	ImageWidth  = 800
+	ImageWidth  = 800 //default display, see DisplayProfiles
 	ImageHeight = 480
 
 	DisplayModel        = 0xc4 //IL075U(R), GDP075FU1 - BW, BWR, BWRY, 7.5 inch
@@ -31,6 +33,7 @@ const (
 	DeviceModeBWRY = "bwry"
 )
 
+// Deprecated: used only by PrintBW, PrintBWR, PrintBWRY, configure Printer instead
 var (
 	WriteDataPause     = 1000
 	ScreenRefreshPause = 5000
@@ -39,148 +42,317 @@ var (
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func PrintBW(portName string, imageData []byte) error {
-	if !imageDataValid(imageData) {
-		return errors.New("image data length mismatch")
-	}
-	return printImage(portName, DeviceModeBW, imageData)
+func PrintBW(transport Transport, imageData []byte) error {
+	return defaultPrinter(transport).PrintBW(imageData)
 }
 
-func PrintBWR(portName string, imageData []byte) error {
-	if !imageDataBWRValid(imageData) {
-		return errors.New("BWR image data length mismatch")
-	}
-	return printImage(portName, DeviceModeBWR, imageData)
+func PrintBWR(transport Transport, imageData []byte) error {
+	return defaultPrinter(transport).PrintBWR(imageData)
 }
 
-func PrintBWRY(portName string, imageData []byte) error {
-	if !imageDataBWRYValid(imageData) {
-		return errors.New("BWRY image data length mismatch")
-	}
-	return printImage(portName, DeviceModeBWRY, imageData)
+func PrintBWRY(transport Transport, imageData []byte) error {
+	return defaultPrinter(transport).PrintBWRY(imageData)
+}
+
+func PrintBWContext(ctx context.Context, transport Transport, imageData []byte) error {
+	return defaultPrinter(transport).PrintBWContext(ctx, imageData)
+}
+
+func PrintBWRContext(ctx context.Context, transport Transport, imageData []byte) error {
+	return defaultPrinter(transport).PrintBWRContext(ctx, imageData)
+}
+
+func PrintBWRYContext(ctx context.Context, transport Transport, imageData []byte) error {
+	return defaultPrinter(transport).PrintBWRYContext(ctx, imageData)
+}
+
+func defaultPrinter(transport Transport) *Printer {
+	p := NewPrinter(transport)
+	p.WriteDataPause = time.Duration(WriteDataPause) * time.Millisecond
+	p.ScreenRefreshPause = time.Duration(ScreenRefreshPause) * time.Millisecond
+	p.ReadDeviceOutput = ReadDeviceOutput
+	return p
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func preparePort(portName string) (serial.Port, error) {
-	log.Debug("test port")
-	if err := testPort(portName); err != nil {
-		return nil, fmt.Errorf("unable to test port: %s", err)
+func (p *Printer) preparePort(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &InterruptedError{Phase: PhaseOpen, Err: err}
 	}
-
-	log.Debug("open port")
-	port, err := serial.Open(portName, portMode())
-	if err != nil {
-		return nil, fmt.Errorf("unable to open port %s: %s", portName, err)
+	setTransportLogger(p.Transport, p.Logger)
+	if err := p.Transport.Open(); err != nil {
+		return err
 	}
+	return nil
+}
 
-	//setup port
-
-	log.Debug("set port RTS")
-	if err := port.SetRTS(true); err != nil {
-		return nil, fmt.Errorf("unable to set RTS: %s", err)
+// setTransportLogger makes transport without own logger use printer logger
+func setTransportLogger(transport Transport, logger log.FieldLogger) {
+	switch t := transport.(type) {
+	case *SerialTransport:
+		if t.Logger == nil {
+			t.Logger = logger
+		}
+	case *NetworkTransport:
+		if t.Logger == nil {
+			t.Logger = logger
+		}
+	case *RecordingTransport:
+		setTransportLogger(t.Transport, logger)
 	}
+}
 
-	log.Debug("set port read timeout to unlimited")
-	if err := port.SetReadTimeout(serial.NoTimeout); err != nil {
-		return nil, fmt.Errorf("unable to set read timeout: %s", err)
+// lock takes cross-process lock on port if enabled, returned function releases it
+func (p *Printer) lock(ctx context.Context) (func(), error) {
+	if !p.Lock {
+		return func() {}, nil
 	}
 
-	return port, nil
+	p.Logger.Debug("lock device")
+	lock, err := lockDevice(ctx, p.Transport, p.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return lock.unlock, nil
 }
 
-func handshake(port serial.Port, displayModel byte, deviceMode string) error {
-	log.Debug("send handshake request")
-	if _, err := port.Write(handshakeRequest(displayModel, deviceMode)); err != nil {
-		return fmt.Errorf("unable to send handshake request: %s", err)
+func (p *Printer) handshake(ctx context.Context, deviceMode string) (*HandshakeResponse, error) {
+	request := handshakeRequest(p.Display.Width, p.Display.Height, p.Display.Model, deviceMode)
+
+	p.Logger.Debug("send handshake request")
+	if _, err := p.Transport.Write(request); err != nil {
+		return nil, interrupted(ctx, PhaseHandshake, fmt.Errorf("unable to send handshake request: %w", err))
 	}
 
-	time.Sleep(time.Duration(WriteDataPause) * time.Millisecond)
+	if err := sleep(ctx, p.WriteDataPause); err != nil {
+		return nil, interrupted(ctx, PhaseHandshake, err)
+	}
 
-	log.Debug("read handshake response")
-	buf, err := readPortData(port)
+	p.Logger.Debug("read handshake response")
+	buf, err := p.readPortData()
 	if err != nil {
-		return fmt.Errorf("unable to read handshake response: %s", err)
+		return nil, interrupted(ctx, PhaseHandshake, fmt.Errorf("unable to read handshake response: %w", err))
 	}
 
-	log.Debugf("handshake response: %s", printable(buf))
+	p.Logger.Debugf("handshake response: %s", printable(buf))
 
 	if err := validateHandshakeResponse(buf); err != nil {
-		return fmt.Errorf("unable to validate handshake response: %s", err)
+		return nil, fmt.Errorf("unable to validate handshake response: %w", err)
 	}
 
-	return nil
+	return parseHandshakeResponse(request, buf), nil
 }
 
-func printImage(portName string, deviceMode string, imageData []byte) error {
-	//open port
+func (p *Printer) printImage(ctx context.Context, deviceMode string, imageData []byte) error {
+	if p.Display.Model == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownModel, p.Display.Name)
+	}
+	if err := CheckFlowControl(p.FlowControl); err != nil {
+		return err
+	}
 
-	port, err := preparePort(portName)
+	unlock, err := p.lock(ctx)
 	if err != nil {
 		return err
 	}
+	defer unlock()
+
+	//skip unchanged frame, state is checked and updated under device lock
+	device := transportName(p.Transport)
+	useState := len(p.StateFile) > 0 && len(device) > 0
+	hash := frameHash(p.Display, deviceMode, imageData)
+
+	if useState && !p.Force {
+		if state, err := loadFrameState(p.StateFile, device); err != nil {
+			p.Logger.Warnf("unable to read state file: %s", err)
+		} else if state != nil && state.Hash == hash {
+			p.Logger.Infof("frame has not changed since %s, skip printing", state.Time.Format(time.DateTime))
+			return nil
+		}
+	}
+
+	err = p.printImageRetry(ctx, deviceMode, imageData)
+
+	if useState {
+		//failed print may leave partial frame on screen, so the next one is printed anyway
+		var state *frameState
+		if err == nil {
+			state = &frameState{
+				Hash:       hash,
+				Display:    p.Display.Name,
+				DeviceMode: deviceMode,
+				Time:       time.Now(),
+			}
+		}
+		if err := saveFrameState(p.StateFile, device, state); err != nil {
+			p.Logger.Warnf("unable to write state file: %s", err)
+		}
+	}
+
+	return err
+}
+
+func (p *Printer) printImageRetry(ctx context.Context, deviceMode string, imageData []byte) error {
+	attempts := max(1, p.Retry.Attempts)
+	backoff := p.Retry.Backoff
+	retryErr := &RetryError{}
+
+	for attempt := 1; ; attempt++ {
+		err := p.printImageAttempt(ctx, deviceMode, imageData)
+		if err == nil {
+			return nil
+		}
+
+		var interruptedErr *InterruptedError
+		if errors.As(err, &interruptedErr) {
+			return err
+		}
+		if attempts == 1 {
+			return err
+		}
+
+		retryErr.Errors = append(retryErr.Errors, err)
+		if attempt >= attempts {
+			return retryErr
+		}
+
+		p.Logger.Warnf("attempt %d/%d failed: %s, retry in %s", attempt, attempts, err, backoff)
+		if err := sleep(ctx, backoff); err != nil {
+			return &InterruptedError{Phase: PhaseOpen, Err: err}
+		}
+
+		backoff *= 2
+		if p.Retry.MaxBackoff > 0 && backoff > p.Retry.MaxBackoff {
+			backoff = p.Retry.MaxBackoff
+		}
+	}
+}
+
+func (p *Printer) printImageAttempt(ctx context.Context, deviceMode string, imageData []byte) error {
+	progress := newProgressTracker(p, imageData)
+
+	//open port
+
+	progress.report(PhaseOpen, 0, 0)
+
+	if err := p.preparePort(ctx); err != nil {
+		return err
+	}
+	defer p.Transport.Close()
+
+	//closing transport unblocks pending reads and writes on cancellation
+	stop := context.AfterFunc(ctx, func() {
+		p.Transport.Close()
+	})
+	defer stop()
 
 	//handshake
 
-	log.Debug("handshake")
-	if err := handshake(port, DisplayModel, deviceMode); err != nil {
-		return fmt.Errorf("unable to handshake: %s", err)
+	progress.report(PhaseHandshake, 0, 0)
+	p.Logger.Debug("handshake")
+	if response, err := p.handshake(ctx, deviceMode); err != nil {
+		var interruptedErr *InterruptedError
+		if errors.As(err, &interruptedErr) {
+			return err
+		}
+		return fmt.Errorf("unable to handshake: %w", err)
 	} else {
-		log.Info("handshake ok")
+		p.Logger.Info("handshake ok")
+		p.Logger.Debugf("handshake: %s", response)
+		if p.OnHandshake != nil {
+			p.OnHandshake(response)
+		}
 	}
 
 	//print
 
-	return printImageImpl(port, imageData)
+	if err := p.printImageImpl(ctx, imageData, progress); err != nil {
+		return err
+	}
+
+	progress.report(PhaseDone, progress.chunks, len(imageData))
+
+	return nil
 }
 
-func printImageImpl(port serial.Port, imageData []byte) error {
+func (p *Printer) printImageImpl(ctx context.Context, imageData []byte, progress *progressTracker) error {
 	chunkIdx := 0
+	acks := &ackReader{printer: p}
+
+	progress.report(PhaseUpload, 0, 0)
 
-	for chunkStart := 0; chunkStart < len(imageData); chunkStart += 4096 {
-		chunkLength := min(4096, len(imageData)-chunkStart)
+	chunkSize := p.Display.chunkSize()
+
+	for chunkStart := 0; chunkStart < len(imageData); chunkStart += chunkSize {
+		chunkLength := min(chunkSize, len(imageData)-chunkStart)
 		chunk := imageData[chunkStart : chunkStart+chunkLength]
 
-		log.Debugf("write chunk #%d (%d bytes)", chunkIdx, len(chunk))
-		if err := writePortData(port, chunk); err != nil {
-			return fmt.Errorf("unable to write chunk: %s", err)
+		p.Logger.Debugf("write chunk #%d (%d bytes)", chunkIdx, len(chunk))
+		if err := writePortData(p.Transport, chunk); err != nil {
+			return interrupted(ctx, PhaseUpload, fmt.Errorf("unable to write chunk: %w", err))
 		}
 
-		log.Debugf("write CRLF after chunk #%d", chunkIdx)
-		if err := writePortData(port, []byte{CR, LF}); err != nil {
-			return fmt.Errorf("unable to write CRLF after chunk #%d: %s", chunkIdx, err)
+		p.Logger.Debugf("write CRLF after chunk #%d", chunkIdx)
+		if err := writePortData(p.Transport, []byte{CR, LF}); err != nil {
+			return interrupted(ctx, PhaseUpload, fmt.Errorf("unable to write CRLF after chunk #%d: %w", chunkIdx, err))
 		}
 
-		if ReadDeviceOutput {
-			log.Debugf("read data after chunk #%d (1-st line)", chunkIdx)
-			if _, err := readPortData(port); err != nil {
-				return fmt.Errorf("unable to read data: %s", err)
+		if p.FlowControl == FlowControlAck {
+			acked, err := acks.wait(2*(chunkIdx+1), p.WriteDataPause)
+			if err != nil {
+				return interrupted(ctx, PhaseUpload, fmt.Errorf("unable to read chunk #%d acknowledgement: %w", chunkIdx, err))
 			}
-
-			log.Debugf("read data after chunk #%d (2-nd line)", chunkIdx)
-			if _, err := readPortData(port); err != nil {
-				return fmt.Errorf("unable to read data: %s", err)
+			if acked {
+				p.Logger.Debugf("chunk #%d acknowledged", chunkIdx)
+			} else {
+				p.Logger.Debugf("chunk #%d not acknowledged in %s, continue", chunkIdx, p.WriteDataPause)
+			}
+		} else if p.ReadDeviceOutput {
+			//lines are counted, network transports may deliver both lines (or lines of several chunks) in one read
+			p.Logger.Debugf("read data after chunk #%d", chunkIdx)
+			if _, err := acks.wait(2*(chunkIdx+1), NoTimeout); err != nil {
+				return interrupted(ctx, PhaseUpload, fmt.Errorf("unable to read data: %w", err))
 			}
 		}
 
-		time.Sleep(time.Duration(WriteDataPause) * time.Millisecond)
+		if p.FlowControl != FlowControlAck {
+			if err := sleep(ctx, p.WriteDataPause); err != nil {
+				return interrupted(ctx, PhaseUpload, err)
+			}
+		}
 
 		chunkIdx++
+
+		progress.report(PhaseUpload, chunkIdx, chunkStart+chunkLength)
+	}
+
+	if p.FlowControl == FlowControlAck {
+		if err := p.Transport.SetReadTimeout(NoTimeout); err != nil {
+			return interrupted(ctx, PhaseUpload, fmt.Errorf("unable to reset read timeout: %w", err))
+		}
 	}
 
-	log.Debug("draining output buffer...")
-	if err := port.Drain(); err != nil {
-		return fmt.Errorf("unable to drain output buffer: %s", err)
+	progress.report(PhaseDrain, chunkIdx, len(imageData))
+	p.Logger.Debug("draining output buffer...")
+	if err := p.Transport.Drain(); err != nil {
+		return interrupted(ctx, PhaseDrain, fmt.Errorf("unable to drain output buffer: %w", err))
 	}
 
-	log.Info("waiting for screen to refresh")
-	time.Sleep(time.Duration(ScreenRefreshPause) * time.Millisecond)
+	progress.report(PhaseRefresh, chunkIdx, len(imageData))
+	p.Logger.Info("waiting for screen to refresh")
+	if err := sleep(ctx, p.ScreenRefreshPause); err != nil {
+		return interrupted(ctx, PhaseRefresh, err)
+	}
 
-	if ReadDeviceOutput {
-		log.Debugf("read remaining data")
-		remaining, err := readPortData(port)
-		if err != nil {
-			return fmt.Errorf("unable to read data: %s", err)
+	if p.ReadDeviceOutput {
+		p.Logger.Debugf("read remaining data")
+		remaining := acks.rest
+		if len(remaining) == 0 {
+			var err error
+			if remaining, err = p.readPortData(); err != nil {
+				return interrupted(ctx, PhaseRefresh, fmt.Errorf("unable to read data: %w", err))
+			}
 		}
 
 		bytesReceived, err := extractReceivedBytes(remaining)
@@ -188,21 +360,82 @@ func printImageImpl(port serial.Port, imageData []byte) error {
 			return err
 		}
 
-		log.Debugf("bytes received: %d", bytesReceived)
+		p.Logger.Debugf("bytes received: %d", bytesReceived)
 		if bytesReceived != len(imageData) {
-			return errors.New("received incorrect number of bytes from display")
+			return &ByteCountError{Expected: len(imageData), Received: bytesReceived}
 		}
 	}
 
-	log.Debugf("reset input buffer...")
-	if err := port.ResetInputBuffer(); err != nil {
-		return fmt.Errorf("unable to reset input buffer: %s", err)
+	p.Logger.Debugf("reset input buffer...")
+	if err := p.Transport.ResetInputBuffer(); err != nil {
+		return interrupted(ctx, PhaseRefresh, fmt.Errorf("unable to reset input buffer: %w", err))
 	}
 
-	log.Debugf("reset output buffer...")
-	if err := port.ResetOutputBuffer(); err != nil {
-		return fmt.Errorf("unable to reset output buffer: %s", err)
+	p.Logger.Debugf("reset output buffer...")
+	if err := p.Transport.ResetOutputBuffer(); err != nil {
+		return interrupted(ctx, PhaseRefresh, fmt.Errorf("unable to reset output buffer: %w", err))
 	}
 
 	return nil
 }
+
+func (p *Printer) readPortData() ([]byte, error) {
+	buf := make([]byte, 1024)
+
+	count, err := p.Transport.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Logger.Debugf("read %d bytes: \"%s\"", count, printable(buf[:count]))
+
+	return buf[:count], nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// ackReader counts lines printed by the board after each chunk
+type ackReader struct {
+	printer *Printer
+	lines   int
+	rest    []byte //data after the last line
+}
+
+// wait reads device output until total number of lines reaches expected value or timeout expires,
+// NoTimeout - wait for lines without limit
+func (r *ackReader) wait(lines int, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+
+	for r.lines < lines {
+		if timeout == NoTimeout {
+			if err := r.printer.Transport.SetReadTimeout(NoTimeout); err != nil {
+				return false, err
+			}
+		} else {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return false, nil
+			}
+			if err := r.printer.Transport.SetReadTimeout(left); err != nil {
+				return false, err
+			}
+		}
+
+		buf, err := r.printer.readPortData()
+		if err != nil {
+			return false, err
+		}
+
+		r.rest = append(r.rest, buf...)
+		for {
+			idx := bytes.IndexByte(r.rest, LF)
+			if idx < 0 {
+				break
+			}
+			r.lines++
+			r.rest = r.rest[idx+1:]
+		}
+	}
+
+	return true, nil
+}
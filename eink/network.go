@@ -0,0 +1,294 @@
+package eink
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SchemeTCP     = "tcp://"
+	SchemeRFC2217 = "rfc2217://"
+
+	networkDialTimeout = 10 * time.Second
+	networkPurgeWait   = 50 * time.Millisecond
+)
+
+// NewTransport selects transport by device name:
+// tcp://host:port - raw TCP serial bridge (ser2net style),
+// rfc2217://host:port - telnet com port control,
+// anything else is a local serial port name
+func NewTransport(device string) Transport {
+	if address, rfc2217, ok := ParseNetworkAddress(device); ok {
+		return NewNetworkTransport(address, rfc2217)
+	}
+	return NewSerialTransport(device)
+}
+
+// ParseNetworkAddress splits tcp:// or rfc2217:// device name to host:port address and protocol
+func ParseNetworkAddress(device string) (address string, rfc2217 bool, ok bool) {
+	switch {
+	case strings.HasPrefix(device, SchemeTCP):
+		return strings.TrimPrefix(device, SchemeTCP), false, true
+	case strings.HasPrefix(device, SchemeRFC2217):
+		return strings.TrimPrefix(device, SchemeRFC2217), true, true
+	default:
+		return "", false, false
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// NetworkTransport is a Transport connected to remote serial port over TCP
+type NetworkTransport struct {
+	Address string
+	RFC2217 bool
+	Logger  log.FieldLogger //nil - standard logger
+
+	mu          sync.Mutex
+	conn        net.Conn
+	readTimeout time.Duration
+	decoder     *telnetDecoder
+	agreed      map[[2]byte]bool
+}
+
+func NewNetworkTransport(address string, rfc2217 bool) *NetworkTransport {
+	return &NetworkTransport{
+		Address:     address,
+		RFC2217:     rfc2217,
+		readTimeout: NoTimeout,
+	}
+}
+
+func (t *NetworkTransport) Open() error {
+	t.logger().Debugf("connect to %s", t.Address)
+	conn, err := net.DialTimeout("tcp", t.Address, networkDialTimeout)
+	if err != nil {
+		return &PortError{PortName: t.Address, Err: err}
+	}
+
+	t.mu.Lock()
+	t.conn = conn
+	t.readTimeout = NoTimeout
+	t.agreed = map[[2]byte]bool{}
+	t.decoder = &telnetDecoder{
+		onCommand: t.negotiate,
+		onSubnegotiation: func(data []byte) {
+			t.logger().Debugf("rfc2217: server subnegotiation: %x", data)
+		},
+	}
+	t.mu.Unlock()
+
+	if t.RFC2217 {
+		if err := t.setupComPort(conn); err != nil {
+			t.Close()
+			return &PortError{PortName: t.Address, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func (t *NetworkTransport) logger() log.FieldLogger {
+	if t.Logger == nil {
+		return log.StandardLogger()
+	}
+	return t.Logger
+}
+
+func (t *NetworkTransport) setupComPort(conn net.Conn) error {
+	t.logger().Debug("rfc2217: setup com port")
+
+	var request []byte
+	request = append(request, t.agree(telnetWILL, telnetOptionBinary)...)
+	request = append(request, t.agree(telnetDO, telnetOptionBinary)...)
+	request = append(request, t.agree(telnetWILL, telnetOptionComPort)...)
+	request = append(request, comPortBaudRate(PortBaudRate)...)
+	request = append(request, comPortCommand(comPortSetDataSize, PortDataBits)...)
+	request = append(request, comPortCommand(comPortSetParity, comPortParityNone)...)
+	request = append(request, comPortCommand(comPortSetStopSize, comPortStopSizeOne)...)
+	request = append(request, comPortCommand(comPortSetControl, comPortControlNoFlow)...)
+	request = append(request, comPortCommand(comPortSetControl, comPortControlRTSOn)...)
+
+	_, err := conn.Write(request)
+	return err
+}
+
+func (t *NetworkTransport) Write(data []byte) (int, error) {
+	conn := t.getConn()
+	if conn == nil {
+		return 0, errTransportClosed
+	}
+
+	if !t.RFC2217 {
+		return conn.Write(data)
+	}
+	if _, err := conn.Write(telnetEscape(data)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (t *NetworkTransport) Read(buf []byte) (int, error) {
+	conn := t.getConn()
+	if conn == nil {
+		return 0, errTransportClosed
+	}
+
+	t.mu.Lock()
+	timeout := t.readTimeout
+	t.mu.Unlock()
+
+	deadline := time.Time{}
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	for {
+		count, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		if !t.RFC2217 {
+			return count, nil
+		}
+
+		//telnet commands are removed, read again if there was no data
+		data := t.decoder.decode(buf[:count])
+		if len(data) > 0 {
+			return copy(buf, data), nil
+		}
+	}
+}
+
+func (t *NetworkTransport) SetReadTimeout(timeout time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readTimeout = timeout
+	return nil
+}
+
+// Drain does nothing: written data is already passed to the network stack
+func (t *NetworkTransport) Drain() error {
+	if t.getConn() == nil {
+		return errTransportClosed
+	}
+	return nil
+}
+
+// ResetInputBuffer discards received data, with RFC 2217 remote buffer is purged too
+func (t *NetworkTransport) ResetInputBuffer() error {
+	conn := t.getConn()
+	if conn == nil {
+		return errTransportClosed
+	}
+
+	if t.RFC2217 {
+		if _, err := conn.Write(comPortCommand(comPortPurgeData, comPortPurgeReceiveData)); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 1024)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(networkPurgeWait)); err != nil {
+			return err
+		}
+		count, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+		if t.RFC2217 {
+			t.decoder.decode(buf[:count])
+		}
+	}
+}
+
+func (t *NetworkTransport) ResetOutputBuffer() error {
+	if t.getConn() == nil {
+		return errTransportClosed
+	}
+	return nil
+}
+
+// Close may be called concurrently with other operations to unblock them
+func (t *NetworkTransport) Close() error {
+	t.mu.Lock()
+	conn := t.conn
+	t.conn = nil
+	t.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (t *NetworkTransport) getConn() net.Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// agree marks option as requested by client, so server confirmation is not answered again
+func (t *NetworkTransport) agree(verb, option byte) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.agreed[[2]byte{verb, option}] = true
+	return telnetCommand(verb, option)
+}
+
+// negotiate answers server telnet option requests, only binary, SGA and com port options are accepted
+func (t *NetworkTransport) negotiate(verb, option byte) {
+	conn := t.getConn()
+	if conn == nil {
+		return
+	}
+
+	var reply byte
+	switch verb {
+	case telnetDO:
+		reply = telnetWONT
+		if option == telnetOptionBinary || option == telnetOptionComPort || option == telnetOptionSGA {
+			reply = telnetWILL
+		}
+	case telnetWILL:
+		reply = telnetDONT
+		if option == telnetOptionBinary || option == telnetOptionComPort || option == telnetOptionSGA {
+			reply = telnetDO
+		}
+	default:
+		return
+	}
+
+	t.mu.Lock()
+	key := [2]byte{reply, option}
+	answered := t.agreed[key]
+	t.agreed[key] = true
+	t.mu.Unlock()
+
+	if answered {
+		return
+	}
+
+	t.logger().Debugf("rfc2217: reply %x to %x %x", reply, verb, option)
+	if _, err := conn.Write(telnetCommand(reply, option)); err != nil {
+		t.logger().Debugf("rfc2217: unable to reply: %s", err)
+	}
+}
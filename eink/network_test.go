@@ -0,0 +1,49 @@
+package eink
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNetworkTransportPrint(t *testing.T) {
+	tests := []struct {
+		name        string
+		rfc2217     bool
+		flowControl string
+	}{
+		{"tcp timed", false, FlowControlTimed},
+		{"tcp ack", false, FlowControlAck},
+		{"rfc2217 timed", true, FlowControlTimed},
+		{"rfc2217 ack", true, FlowControlAck},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			display := DisplayProfiles[0]
+			simulator := NewSimulator(display)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			go NewBridge(simulator, test.rfc2217).Serve(listener)
+
+			printer := testPrinter(NewNetworkTransport(listener.Addr().String(), test.rfc2217), display, DeviceModeBW)
+			printer.FlowControl = test.flowControl
+			printer.ReadDeviceOutput = true
+
+			imageData := testImageData(display.FrameSize(DeviceModeBW))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := printer.PrintContext(ctx, imageData); err != nil {
+				t.Fatalf("print failed: %s", err)
+			}
+
+			assertFrame(t, simulator.Frame(), display, DeviceModeBW, imageData)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package eink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultWriteDataPause     = 1000 * time.Millisecond
+	DefaultScreenRefreshPause = 5000 * time.Millisecond
+
+	FlowControlTimed = "timed" //pause WriteDataPause after each chunk
+	FlowControlAck   = "ack"   //wait for chunk acknowledgement lines, at most WriteDataPause
+)
+
+// Printer holds connection and display settings for a single display
+type Printer struct {
+	Transport  Transport
+	DeviceMode string
+	Display    *DisplayProfile
+
+	WriteDataPause     time.Duration
+	ScreenRefreshPause time.Duration
+	ReadDeviceOutput   bool
+	FlowControl        string //FlowControlTimed or FlowControlAck, empty - timed
+	Retry              RetryPolicy
+	Lock               bool          //take cross-process lock on port for the whole print, see ErrDeviceLocked
+	LockTimeout        time.Duration //wait for lock held by another process, 0 - fail immediately
+	StateFile          string        //remember frames sent to devices, unchanged frame is not printed again, "" - disabled
+	Force              bool          //print frame even if it has not changed
+
+	Logger      log.FieldLogger
+	OnProgress  func(progress Progress)
+	OnHandshake func(response *HandshakeResponse) //called with response of each print attempt
+}
+
+func NewPrinter(transport Transport) *Printer {
+	p := &Printer{
+		Transport:        transport,
+		DeviceMode:       DeviceModeBW,
+		ReadDeviceOutput: false,
+		FlowControl:      FlowControlTimed,
+		Lock:             true,
+		LockTimeout:      DefaultLockTimeout,
+		Logger:           log.StandardLogger(),
+	}
+	p.SetDisplay(DisplayProfiles[0])
+	return p
+}
+
+// SetDisplay selects display profile and its recommended timings
+func (p *Printer) SetDisplay(display *DisplayProfile) {
+	p.Display = display
+	p.WriteDataPause = display.WriteDataPause
+	p.ScreenRefreshPause = display.ScreenRefreshPause
+}
+
+// RetryPolicy defines how failed print is repeated:
+// port is reopened, handshake and the whole frame are sent again
+type RetryPolicy struct {
+	Attempts   int           //total number of attempts, 0 or 1 - no retries
+	Backoff    time.Duration //pause before the second attempt, doubled for each next one
+	MaxBackoff time.Duration //0 - unlimited
+}
+
+// RetryError holds failures of all attempts
+type RetryError struct {
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("all %d attempts failed", len(e.Errors)))
+	for idx, err := range e.Errors {
+		sb.WriteString(fmt.Sprintf("; #%d: %s", idx+1, err))
+	}
+	return sb.String()
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Errors
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Print sends image data prepared for printer DeviceMode
+func (p *Printer) Print(imageData []byte) error {
+	return p.PrintContext(context.Background(), imageData)
+}
+
+func (p *Printer) PrintBW(imageData []byte) error {
+	return p.PrintBWContext(context.Background(), imageData)
+}
+
+func (p *Printer) PrintBWR(imageData []byte) error {
+	return p.PrintBWRContext(context.Background(), imageData)
+}
+
+func (p *Printer) PrintBWRY(imageData []byte) error {
+	return p.PrintBWRYContext(context.Background(), imageData)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// PrintContext is Print that aborts on ctx cancellation or deadline,
+// in that case transport is closed and *InterruptedError is returned
+func (p *Printer) PrintContext(ctx context.Context, imageData []byte) error {
+	switch p.DeviceMode {
+	case DeviceModeBW:
+		return p.PrintBWContext(ctx, imageData)
+	case DeviceModeBWR:
+		return p.PrintBWRContext(ctx, imageData)
+	case DeviceModeBWRY:
+		return p.PrintBWRYContext(ctx, imageData)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownDeviceMode, p.DeviceMode)
+	}
+}
+
+func (p *Printer) PrintBWContext(ctx context.Context, imageData []byte) error {
+	if err := p.CheckMode(DeviceModeBW); err != nil {
+		return err
+	}
+	if len(imageData) != p.Display.FrameSize(DeviceModeBW) {
+		return fmt.Errorf("%w: got %d bytes", ErrImageDataLength, len(imageData))
+	}
+	return p.printImage(ctx, DeviceModeBW, imageData)
+}
+
+func (p *Printer) PrintBWRContext(ctx context.Context, imageData []byte) error {
+	if err := p.CheckMode(DeviceModeBWR); err != nil {
+		return err
+	}
+	if len(imageData) != p.Display.FrameSize(DeviceModeBWR) {
+		return fmt.Errorf("BWR %w: got %d bytes", ErrImageDataLength, len(imageData))
+	}
+	return p.printImage(ctx, DeviceModeBWR, imageData)
+}
+
+func (p *Printer) PrintBWRYContext(ctx context.Context, imageData []byte) error {
+	if err := p.CheckMode(DeviceModeBWRY); err != nil {
+		return err
+	}
+	if len(imageData) != p.Display.FrameSize(DeviceModeBWRY) {
+		return fmt.Errorf("BWRY %w: got %d bytes", ErrImageDataLength, len(imageData))
+	}
+	return p.printImage(ctx, DeviceModeBWRY, imageData)
+}
+
+// CheckFlowControl returns ErrUnknownFlowControl for values other than FlowControlTimed and FlowControlAck
+func CheckFlowControl(flowControl string) error {
+	switch flowControl {
+	case FlowControlTimed, FlowControlAck, "":
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFlowControl, flowControl)
+	}
+}
+
+// CheckMode returns *UnsupportedModeError when display can not work in device mode
+func (p *Printer) CheckMode(deviceMode string) error {
+	if !p.Display.SupportsMode(deviceMode) {
+		return &UnsupportedModeError{
+			Display:    p.Display.Name,
+			DeviceMode: deviceMode,
+			Supported:  p.Display.Modes,
+		}
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Probe checks that transport can be opened, nothing is sent to device:
+// handshake announces a frame which the board then waits for
+func (p *Printer) Probe(ctx context.Context) error {
+	unlock, err := p.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.preparePort(ctx); err != nil {
+		return err
+	}
+	return p.Transport.Close()
+}
@@ -0,0 +1,133 @@
+package eink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrinterUnknownFlowControl(t *testing.T) {
+	display := DisplayProfiles[0]
+	printer := testPrinter(NewSimulator(display), display, DeviceModeBW)
+	printer.FlowControl = "acks"
+
+	err := printer.Print(testImageData(display.FrameSize(DeviceModeBW)))
+	if !errors.Is(err, ErrUnknownFlowControl) {
+		t.Fatalf("error %v, expected %v", err, ErrUnknownFlowControl)
+	}
+}
+
+func TestPrinterImageDataLength(t *testing.T) {
+	display := DisplayProfiles[0]
+
+	for _, deviceMode := range display.Modes {
+		t.Run(deviceMode, func(t *testing.T) {
+			printer := testPrinter(NewSimulator(display), display, deviceMode)
+
+			err := printer.Print(testImageData(display.FrameSize(deviceMode) - 1))
+			if !errors.Is(err, ErrImageDataLength) {
+				t.Fatalf("error %v, expected %v", err, ErrImageDataLength)
+			}
+		})
+	}
+}
+
+func TestPrinterUnknownModel(t *testing.T) {
+	display, err := GetDisplayProfile("4.2in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulator := NewSimulator(display)
+	imageData := testImageData(display.FrameSize(DeviceModeBW))
+
+	err = testPrinter(simulator, display, DeviceModeBW).Print(imageData)
+	if !errors.Is(err, ErrUnknownModel) {
+		t.Fatalf("error %v, expected %v", err, ErrUnknownModel)
+	}
+
+	configured := *display
+	configured.Model = 0x01
+	if err := testPrinter(simulator, &configured, DeviceModeBW).Print(imageData); err != nil {
+		t.Fatalf("print failed: %s", err)
+	}
+	assertFrame(t, simulator.Frame(), display, DeviceModeBW, imageData)
+}
+
+func TestPrinterDeadline(t *testing.T) {
+	display := DisplayProfiles[0]
+	simulator := NewSimulator(display)
+	printer := testPrinter(simulator, display, DeviceModeBW)
+	printer.WriteDataPause = 50 * time.Millisecond
+
+	//handshake takes one pause, upload of 12 chunks takes 12 pauses
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	err := printer.PrintContext(ctx, testImageData(display.FrameSize(DeviceModeBW)))
+	var interruptedErr *InterruptedError
+	if !errors.As(err, &interruptedErr) || interruptedErr.Phase != PhaseUpload {
+		t.Fatalf("error %v, expected interrupted upload", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if simulator.Frame() != nil {
+		t.Error("frame is received")
+	}
+	if _, err := simulator.Write([]byte{0}); !errors.Is(err, errTransportClosed) {
+		t.Error("transport is not closed")
+	}
+}
+
+var errTestOpen = errors.New("test open failure")
+
+// flakyTransport fails the first failures opens
+type flakyTransport struct {
+	Transport
+	failures int
+	opens    int
+}
+
+func (t *flakyTransport) Open() error {
+	t.opens++
+	if t.opens <= t.failures {
+		return errTestOpen
+	}
+	return t.Transport.Open()
+}
+
+func TestPrinterRetry(t *testing.T) {
+	display := DisplayProfiles[0]
+	imageData := testImageData(display.FrameSize(DeviceModeBW))
+
+	t.Run("recovered", func(t *testing.T) {
+		simulator := NewSimulator(display)
+		transport := &flakyTransport{Transport: simulator, failures: 2}
+		printer := testPrinter(transport, display, DeviceModeBW)
+		printer.Retry = RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+		if err := printer.Print(imageData); err != nil {
+			t.Fatalf("print failed: %s", err)
+		}
+		if transport.opens != 3 {
+			t.Errorf("transport opened %d times, expected 3", transport.opens)
+		}
+		assertFrame(t, simulator.Frame(), display, DeviceModeBW, imageData)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		transport := &flakyTransport{Transport: NewSimulator(display), failures: 3}
+		printer := testPrinter(transport, display, DeviceModeBW)
+		printer.Retry = RetryPolicy{Attempts: 2, Backoff: time.Millisecond}
+
+		err := printer.Print(imageData)
+		var retryErr *RetryError
+		if !errors.As(err, &retryErr) || len(retryErr.Errors) != 2 {
+			t.Fatalf("error %v, expected 2 failed attempts", err)
+		}
+		if !errors.Is(err, errTestOpen) {
+			t.Errorf("error %v, expected %v", err, errTestOpen)
+		}
+	})
+}
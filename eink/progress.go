@@ -0,0 +1,71 @@
+package eink
+
+import (
+	"time"
+)
+
+const PhaseDone Phase = "done"
+
+// Progress describes state of running print operation
+type Progress struct {
+	Phase      Phase
+	Chunk      int //chunks sent
+	Chunks     int
+	BytesSent  int
+	BytesTotal int
+	Remaining  time.Duration //estimated time until screen refresh is complete
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type progressTracker struct {
+	printer     *Printer
+	chunks      int
+	bytesTotal  int
+	uploadStart time.Time
+}
+
+func newProgressTracker(p *Printer, imageData []byte) *progressTracker {
+	return &progressTracker{
+		printer:    p,
+		chunks:     (len(imageData) + p.Display.chunkSize() - 1) / p.Display.chunkSize(),
+		bytesTotal: len(imageData),
+	}
+}
+
+func (t *progressTracker) report(phase Phase, chunk, bytesSent int) {
+	if t.printer.OnProgress == nil {
+		return
+	}
+	if phase == PhaseUpload && chunk == 0 {
+		t.uploadStart = time.Now()
+	}
+
+	t.printer.OnProgress(Progress{
+		Phase:      phase,
+		Chunk:      chunk,
+		Chunks:     t.chunks,
+		BytesSent:  bytesSent,
+		BytesTotal: t.bytesTotal,
+		Remaining:  t.remaining(phase, chunk),
+	})
+}
+
+func (t *progressTracker) remaining(phase Phase, chunk int) time.Duration {
+	refresh := t.printer.ScreenRefreshPause
+
+	switch phase {
+	case PhaseOpen, PhaseHandshake:
+		return time.Duration(t.chunks+1)*t.printer.WriteDataPause + refresh
+	case PhaseUpload:
+		perChunk := t.printer.WriteDataPause
+		if chunk > 0 {
+			perChunk = time.Since(t.uploadStart) / time.Duration(chunk)
+		}
+		return time.Duration(t.chunks-chunk)*perChunk + refresh
+	case PhaseDrain, PhaseRefresh:
+		return refresh
+	default:
+		return 0
+	}
+}
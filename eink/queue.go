@@ -0,0 +1,313 @@
+package eink
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type JobState string
+
+const (
+	JobQueued      JobState = "queued"
+	JobHandshaking JobState = "handshaking"
+	JobUploading   JobState = "uploading"
+	JobRefreshing  JobState = "refreshing"
+	JobDone        JobState = "done"
+	JobFailed      JobState = "failed"
+
+	DefaultQueueHistory = 100
+)
+
+// Job is a single print request in Queue
+type Job struct {
+	ID         int64
+	Device     string
+	DeviceMode string
+	Created    time.Time
+
+	printer   *Printer
+	imageData []byte
+	done      chan struct{}
+
+	mu       sync.Mutex
+	state    JobState
+	err      error
+	started  time.Time
+	finished time.Time
+	progress Progress
+}
+
+// JobStatus is a snapshot of Job state
+type JobStatus struct {
+	ID         int64     `json:"id"`
+	Device     string    `json:"device"`
+	DeviceMode string    `json:"device_mode"`
+	State      JobState  `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	Created    time.Time `json:"created"`
+	Started    time.Time `json:"started,omitzero"`
+	Finished   time.Time `json:"finished,omitzero"`
+	Chunk      int       `json:"chunk"`
+	Chunks     int       `json:"chunks"`
+	BytesSent  int       `json:"bytes_sent"`
+	BytesTotal int       `json:"bytes_total"`
+}
+
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Err returns print error of failed job
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := JobStatus{
+		ID:         j.ID,
+		Device:     j.Device,
+		DeviceMode: j.DeviceMode,
+		State:      j.state,
+		Created:    j.Created,
+		Started:    j.started,
+		Finished:   j.finished,
+		Chunk:      j.progress.Chunk,
+		Chunks:     j.progress.Chunks,
+		BytesSent:  j.progress.BytesSent,
+		BytesTotal: j.progress.BytesTotal,
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
+
+// Wait blocks until job is done or failed, returns job error
+func (j *Job) Wait(ctx context.Context) error {
+	select {
+	case <-j.done:
+		return j.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *Job) setProgress(progress Progress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.progress = progress
+	switch progress.Phase {
+	case PhaseOpen, PhaseHandshake:
+		j.state = JobHandshaking
+	case PhaseUpload:
+		j.state = JobUploading
+	case PhaseDrain, PhaseRefresh:
+		j.state = JobRefreshing
+	}
+}
+
+func (j *Job) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state = JobHandshaking
+	j.started = time.Now()
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	j.err = err
+	if err == nil {
+		j.state = JobDone
+	} else {
+		j.state = JobFailed
+	}
+	j.finished = time.Now()
+	j.imageData = nil
+	j.mu.Unlock()
+
+	close(j.done)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Queue prints jobs one by one for each device, different devices are printed concurrently.
+// With Coalesce only the latest waiting job for device is kept, older ones fail with ErrJobSuperseded
+type Queue struct {
+	Coalesce bool
+	Timeout  time.Duration //for a single job, 0 - no timeout
+	History  int           //number of finished jobs kept for lookup
+
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	lastID   int64
+	devices  map[string]*queueDevice
+	jobs     map[int64]*Job
+	finished []int64
+	closed   bool
+}
+
+type queueDevice struct {
+	pending []*Job
+	running bool
+}
+
+func NewQueue() *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		Coalesce: true,
+		History:  DefaultQueueHistory,
+		ctx:      ctx,
+		cancel:   cancel,
+		devices:  map[string]*queueDevice{},
+		jobs:     map[int64]*Job{},
+	}
+}
+
+// Submit adds job printing imageData with printer, jobs with the same device key are serialized.
+// Printer must not be used by caller until job is finished, its OnProgress is replaced
+func (q *Queue) Submit(device string, printer *Printer, imageData []byte) *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.lastID++
+	job := &Job{
+		ID:         q.lastID,
+		Device:     device,
+		DeviceMode: printer.DeviceMode,
+		Created:    time.Now(),
+		printer:    printer,
+		imageData:  imageData,
+		done:       make(chan struct{}),
+		state:      JobQueued,
+	}
+	q.jobs[job.ID] = job
+
+	if q.closed {
+		job.finish(ErrQueueClosed)
+		q.retire(job)
+		return job
+	}
+
+	d := q.devices[device]
+	if d == nil {
+		d = &queueDevice{}
+		q.devices[device] = d
+	}
+
+	if q.Coalesce {
+		for _, superseded := range d.pending {
+			superseded.finish(ErrJobSuperseded)
+			q.retire(superseded)
+		}
+		d.pending = nil
+	}
+	d.pending = append(d.pending, job)
+
+	if !d.running {
+		d.running = true
+		q.wg.Add(1)
+		go q.run(device, d)
+	}
+
+	return job
+}
+
+// Job returns queued, running or recently finished job
+func (q *Queue) Job(id int64) *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.jobs[id]
+}
+
+// Jobs returns all known jobs ordered by id
+func (q *Queue) Jobs() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	slices.SortFunc(jobs, func(a, b *Job) int {
+		return int(a.ID - b.ID)
+	})
+	return jobs
+}
+
+// Close cancels running jobs, fails waiting ones and waits for device workers to stop
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	for _, d := range q.devices {
+		for _, job := range d.pending {
+			job.finish(ErrQueueClosed)
+			q.retire(job)
+		}
+		d.pending = nil
+	}
+	q.mu.Unlock()
+
+	q.cancel()
+	q.wg.Wait()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// run prints pending jobs of a device until there are none
+func (q *Queue) run(device string, d *queueDevice) {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		if len(d.pending) == 0 {
+			d.running = false
+			delete(q.devices, device)
+			q.mu.Unlock()
+			return
+		}
+		job := d.pending[0]
+		d.pending = d.pending[1:]
+		q.mu.Unlock()
+
+		job.finish(q.print(job))
+
+		q.mu.Lock()
+		q.retire(job)
+		q.mu.Unlock()
+	}
+}
+
+func (q *Queue) print(job *Job) error {
+	ctx := q.ctx
+	if q.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.Timeout)
+		defer cancel()
+	}
+
+	job.start()
+	job.printer.OnProgress = job.setProgress
+
+	return job.printer.PrintContext(ctx, job.imageData)
+}
+
+// retire records finished job and removes the oldest finished jobs above History limit, must be called with q.mu held
+func (q *Queue) retire(job *Job) {
+	q.finished = append(q.finished, job.ID)
+	for len(q.finished) > max(0, q.History) {
+		delete(q.jobs, q.finished[0])
+		q.finished = q.finished[1:]
+	}
+}
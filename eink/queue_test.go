@@ -0,0 +1,70 @@
+package eink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueueCoalesce(t *testing.T) {
+	for _, coalesce := range []bool{true, false} {
+		name := "coalesce"
+		if !coalesce {
+			name = "no coalesce"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			display := DisplayProfiles[0]
+			simulator := NewSimulator(display)
+			frameSize := display.FrameSize(DeviceModeBW)
+
+			queue := NewQueue()
+			queue.Coalesce = coalesce
+			defer queue.Close()
+
+			submit := func(fill byte) *Job {
+				printer := testPrinter(simulator, display, DeviceModeBW)
+				printer.ScreenRefreshPause = 100 * time.Millisecond
+				imageData := make([]byte, frameSize)
+				for i := range imageData {
+					imageData[i] = fill
+				}
+				return queue.Submit("simulator", printer, imageData)
+			}
+
+			first := submit(0x00)
+			for first.State() == JobQueued {
+				time.Sleep(time.Millisecond)
+			}
+			second := submit(0x55)
+			third := submit(0xff)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := first.Wait(ctx); err != nil {
+				t.Fatalf("first job failed: %s", err)
+			}
+			err := second.Wait(ctx)
+			if coalesce && !errors.Is(err, ErrJobSuperseded) {
+				t.Fatalf("second job error %v, expected %v", err, ErrJobSuperseded)
+			}
+			if !coalesce && err != nil {
+				t.Fatalf("second job failed: %s", err)
+			}
+			if err := third.Wait(ctx); err != nil {
+				t.Fatalf("third job failed: %s", err)
+			}
+
+			if state := third.State(); state != JobDone {
+				t.Fatalf("third job state %s, expected %s", state, JobDone)
+			}
+			if ids := len(queue.Jobs()); ids != 3 {
+				t.Fatalf("%d jobs in history, expected 3", ids)
+			}
+
+			assertFrame(t, simulator.Frame(), display, DeviceModeBW, third.imageData)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package eink
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ServeConn exchanges data between network client and opened transport until one of them is closed,
+// transport is closed on return. With rfc2217 client telnet options are negotiated
+// and com port commands are acknowledged, port settings are not changed.
+func ServeConn(conn net.Conn, transport Transport, rfc2217 bool) error {
+	writer := &connWriter{conn: conn}
+	defer transport.Close()
+
+	//device to client
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			count, err := transport.Read(buf)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			data := buf[:count]
+			if rfc2217 {
+				data = telnetEscape(data)
+			}
+			if _, err := writer.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+
+	//client to device
+	var decoder *telnetDecoder
+	if rfc2217 {
+		decoder = newComPortServerDecoder(writer, transport)
+	}
+
+	buf := make([]byte, 4096)
+	var result error
+	for {
+		count, err := conn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				result = err
+			}
+			break
+		}
+		data := buf[:count]
+		if decoder != nil {
+			data = decoder.decode(data)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if _, err := transport.Write(data); err != nil {
+			result = err
+			break
+		}
+	}
+
+	transport.Close()
+	<-done
+
+	return result
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type connWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (w *connWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.Write(data)
+}
+
+func newComPortServerDecoder(writer io.Writer, transport Transport) *telnetDecoder {
+	answered := map[[2]byte]bool{}
+
+	reply := func(verb, option byte) {
+		key := [2]byte{verb, option}
+		if answered[key] {
+			return
+		}
+		answered[key] = true
+		if _, err := writer.Write(telnetCommand(verb, option)); err != nil {
+			log.Debugf("rfc2217: unable to reply: %s", err)
+		}
+	}
+
+	return &telnetDecoder{
+		onCommand: func(verb, option byte) {
+			accepted := option == telnetOptionBinary || option == telnetOptionComPort || option == telnetOptionSGA
+			switch verb {
+			case telnetDO:
+				if accepted {
+					reply(telnetWILL, option)
+				} else {
+					reply(telnetWONT, option)
+				}
+			case telnetWILL:
+				if accepted {
+					reply(telnetDO, option)
+				} else {
+					reply(telnetDONT, option)
+				}
+			}
+		},
+		onSubnegotiation: func(data []byte) {
+			if len(data) < 2 || data[0] != telnetOptionComPort {
+				return
+			}
+			command := data[1]
+			value := data[2:]
+
+			log.Debugf("rfc2217: client command %d, value %x", command, value)
+
+			if command == comPortPurgeData && len(value) > 0 && value[0]&comPortPurgeReceiveData != 0 {
+				if err := transport.ResetInputBuffer(); err != nil {
+					log.Debugf("rfc2217: unable to purge data: %s", err)
+				}
+			}
+
+			if _, err := writer.Write(comPortCommand(command+comPortServerBase, value...)); err != nil {
+				log.Debugf("rfc2217: unable to reply: %s", err)
+			}
+		},
+	}
+}
@@ -0,0 +1,303 @@
+package eink
+
+import (
+	"fmt"
+	"go-eink/images"
+	"image"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	simulatorStateHandshake = iota
+	simulatorStateData
+	simulatorStateChunkEnd
+)
+
+// Simulator is an in-process Transport that behaves like the display driver board:
+// it answers handshake, consumes image chunks and reconstructs received frame
+type Simulator struct {
+	Display *DisplayProfile
+	OnFrame func(frame image.Image)
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	opened      bool
+	output      [][]byte
+	readTimeout time.Duration
+
+	state         int
+	input         []byte
+	deviceMode    string
+	frameData     []byte
+	frameExpected int
+	chunkIdx      int
+	chunkLength   int
+	chunkReceived int
+	frame         image.Image
+}
+
+func NewSimulator(display *DisplayProfile) *Simulator {
+	s := &Simulator{
+		Display:     display,
+		readTimeout: NoTimeout,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Frame returns last frame received by simulator or nil
+func (s *Simulator) Frame() image.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frame
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Simulator) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.opened = true
+	s.output = nil
+	s.readTimeout = NoTimeout
+	s.reset()
+
+	return nil
+}
+
+func (s *Simulator) Write(data []byte) (int, error) {
+	s.mu.Lock()
+
+	if !s.opened {
+		s.mu.Unlock()
+		return 0, errTransportClosed
+	}
+
+	s.input = append(s.input, data...)
+	frames := s.process()
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if s.OnFrame != nil {
+		for _, frame := range frames {
+			s.OnFrame(frame)
+		}
+	}
+
+	return len(data), nil
+}
+
+func (s *Simulator) Read(buf []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readTimeout >= 0 && s.opened && len(s.output) == 0 {
+		timer := time.AfterFunc(s.readTimeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.cond.Broadcast()
+		})
+		defer timer.Stop()
+	}
+
+	deadline := time.Now().Add(s.readTimeout)
+	for s.opened && len(s.output) == 0 {
+		if s.readTimeout >= 0 && !time.Now().Before(deadline) {
+			return 0, nil
+		}
+		s.cond.Wait()
+	}
+	if !s.opened {
+		return 0, errTransportClosed
+	}
+
+	count := copy(buf, s.output[0])
+	if count < len(s.output[0]) {
+		s.output[0] = s.output[0][count:]
+	} else {
+		s.output = s.output[1:]
+	}
+
+	return count, nil
+}
+
+func (s *Simulator) SetReadTimeout(timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readTimeout = timeout
+	return nil
+}
+
+func (s *Simulator) Drain() error {
+	return nil
+}
+
+func (s *Simulator) ResetInputBuffer() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.output = nil
+	return nil
+}
+
+func (s *Simulator) ResetOutputBuffer() error {
+	return nil
+}
+
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opened = false
+	s.cond.Broadcast()
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Simulator) reset() {
+	s.state = simulatorStateHandshake
+	s.input = nil
+	s.frameData = nil
+	s.frameExpected = 0
+	s.chunkIdx = 0
+	s.chunkLength = 0
+	s.chunkReceived = 0
+}
+
+func (s *Simulator) send(data []byte) {
+	s.output = append(s.output, data)
+}
+
+func (s *Simulator) process() []image.Image {
+	var frames []image.Image
+
+	for {
+		switch s.state {
+		case simulatorStateHandshake:
+			if !s.processHandshake() {
+				return frames
+			}
+		case simulatorStateData:
+			if !s.processData() {
+				return frames
+			}
+		case simulatorStateChunkEnd:
+			frame, ok := s.processChunkEnd()
+			if frame != nil {
+				frames = append(frames, frame)
+			}
+			if !ok {
+				return frames
+			}
+		}
+	}
+}
+
+func (s *Simulator) processHandshake() bool {
+	//skip garbage before handshake start
+	for len(s.input) > 0 && s.input[0] != 0xaa {
+		s.input = s.input[1:]
+	}
+	if len(s.input) < 12 {
+		return false
+	}
+
+	request := s.input[:12]
+	if err := validateHandshakeRequest(request); err != nil {
+		log.Warnf("simulator: invalid handshake request: %s", err)
+		s.input = s.input[1:]
+		return true
+	}
+	s.input = s.input[12:]
+
+	s.deviceMode = DeviceModeBW
+	if request[7] == DisplayModeByteBWR {
+		s.deviceMode = DeviceModeBWR
+	}
+	if request[5] == DisplayModeByteBWRY {
+		s.deviceMode = DeviceModeBWRY
+	}
+
+	s.frameExpected = int(request[3])*256 + int(request[4])
+	if s.deviceMode != DeviceModeBW {
+		s.frameExpected *= 2
+	}
+	s.frameData = make([]byte, 0, s.frameExpected)
+	s.chunkIdx = 0
+	s.chunkLength = 0
+
+	log.Debugf("simulator: handshake, mode=%s, expecting %d bytes", s.deviceMode, s.frameExpected)
+
+	s.send(handshakeResponse(request))
+
+	if s.frameExpected > 0 {
+		s.state = simulatorStateData
+	}
+
+	return true
+}
+
+func (s *Simulator) processData() bool {
+	if s.chunkLength == 0 {
+		s.chunkLength = min(s.Display.chunkSize(), s.frameExpected-len(s.frameData))
+		s.chunkReceived = 0
+	}
+
+	count := min(s.chunkLength-s.chunkReceived, len(s.input))
+	if count == 0 {
+		return false
+	}
+
+	s.frameData = append(s.frameData, s.input[:count]...)
+	s.input = s.input[count:]
+	s.chunkReceived += count
+
+	if s.chunkReceived == s.chunkLength {
+		s.state = simulatorStateChunkEnd
+	}
+
+	return true
+}
+
+func (s *Simulator) processChunkEnd() (image.Image, bool) {
+	if len(s.input) < 2 {
+		return nil, false
+	}
+	if s.input[0] != CR || s.input[1] != LF {
+		log.Warnf("simulator: chunk #%d is not terminated with CRLF", s.chunkIdx)
+	}
+	s.input = s.input[2:]
+
+	s.send([]byte(fmt.Sprintf("chunk #%d: %d bytes\r\n", s.chunkIdx, s.chunkLength)))
+	s.send([]byte(fmt.Sprintf("total: %d/%d\r\n", len(s.frameData), s.frameExpected)))
+
+	s.chunkIdx++
+	s.chunkLength = 0
+	s.state = simulatorStateData
+
+	if len(s.frameData) < s.frameExpected {
+		return nil, true
+	}
+
+	s.refresh()
+	s.send([]byte(fmt.Sprintf("bytes received=%d", len(s.frameData))))
+	s.reset()
+
+	return s.frame, true
+}
+
+func (s *Simulator) refresh() {
+	switch s.deviceMode {
+	case DeviceModeBWR:
+		s.frame = images.FromImageDataBWR(s.frameData, s.Display.Width, s.Display.Height)
+	case DeviceModeBWRY:
+		s.frame = images.FromImageDataBWRY(s.frameData, s.Display.Width, s.Display.Height)
+	default:
+		s.frame = images.FromImageDataBW(s.frameData, s.Display.Width, s.Display.Height)
+	}
+
+	log.Infof("simulator: frame received (%d bytes, mode=%s)", len(s.frameData), s.deviceMode)
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+package eink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SimulatorPty exposes Simulator on a pseudo-terminal,
+// so it can be used as a regular serial device by another process
+type SimulatorPty struct {
+	Name string
+
+	simulator *Simulator
+	master    *os.File
+	slave     *os.File
+}
+
+func NewSimulatorPty(simulator *Simulator) (*SimulatorPty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open pty master: %w", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unable to unlock pty: %w", err)
+	}
+
+	var ptyNumber uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptyNumber))); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unable to get pty number: %w", err)
+	}
+	name := fmt.Sprintf("/dev/pts/%d", ptyNumber)
+
+	//keep slave open, so master does not get EIO between client sessions
+	slave, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unable to open pty slave: %w", err)
+	}
+	if err := setRawMode(slave.Fd()); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("unable to set pty raw mode: %w", err)
+	}
+
+	if err := simulator.Open(); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, err
+	}
+
+	p := &SimulatorPty{
+		Name:      name,
+		simulator: simulator,
+		master:    master,
+		slave:     slave,
+	}
+
+	go p.readLoop()
+	go p.writeLoop()
+
+	return p, nil
+}
+
+func (p *SimulatorPty) Close() error {
+	p.simulator.Close()
+	p.slave.Close()
+	return p.master.Close()
+}
+
+func (p *SimulatorPty) readLoop() {
+	buf := make([]byte, 4096)
+	for {
+		count, err := p.master.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Errorf("simulator pty: unable to read: %s", err)
+			}
+			return
+		}
+		if _, err := p.simulator.Write(buf[:count]); err != nil {
+			return
+		}
+	}
+}
+
+func (p *SimulatorPty) writeLoop() {
+	buf := make([]byte, 1024)
+	for {
+		count, err := p.simulator.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := p.master.Write(buf[:count]); err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Errorf("simulator pty: unable to write: %s", err)
+			}
+			return
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setRawMode(fd uintptr) error {
+	var termios syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); err != nil {
+		return err
+	}
+
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+}
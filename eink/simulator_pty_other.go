@@ -0,0 +1,17 @@
+//go:build !linux
+
+package eink
+
+import "errors"
+
+type SimulatorPty struct {
+	Name string
+}
+
+func NewSimulatorPty(simulator *Simulator) (*SimulatorPty, error) {
+	return nil, errors.New("pseudo-terminal simulator is supported only on linux")
+}
+
+func (p *SimulatorPty) Close() error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package eink
+
+import (
+	"go-eink/images"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestSimulatorPrint renders test image for each device mode, prints it to simulator
+// and checks that received frame is the same as preview
+func TestSimulatorPrint(t *testing.T) {
+	display := DisplayProfiles[0]
+	img := testImage(display.Width, display.Height)
+
+	blendMode := images.StringToBlendMode("BYR")
+	bw := images.Dithering(img, &images.PixelTransformationGrayscale{Threshold: 128}, images.DitheringFloydSteinberg)
+	rw := images.Dithering(img, &images.PixelTransformationRed{Threshold: 128, RedHueThreshold: 25}, images.DitheringSierra)
+	yw := images.Dithering(img, &images.PixelTransformationYellow{Threshold: 180, YellowHueThreshold: 25}, images.DitheringStucki)
+
+	tests := []struct {
+		deviceMode string
+		imageData  []byte
+		preview    image.Image
+	}{
+		{DeviceModeBW, images.ToImageDataBW(bw), bw},
+		{DeviceModeBWR, images.ToImageDataBWR(blendMode, bw, rw), images.JoinBWR(blendMode, bw, rw)},
+		{DeviceModeBWRY, images.ToImageDataBWRY(blendMode, bw, rw, yw), images.JoinBWRY(blendMode, bw, rw, yw)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.deviceMode, func(t *testing.T) {
+			simulator := NewSimulator(display)
+			printer := testPrinter(simulator, display, test.deviceMode)
+
+			if err := printer.Print(test.imageData); err != nil {
+				t.Fatalf("print failed: %s", err)
+			}
+
+			frame := simulator.Frame()
+			assertFrame(t, frame, display, test.deviceMode, test.imageData)
+			assertPreview(t, frame, test.preview, test.deviceMode, test.imageData)
+		})
+	}
+}
+
+// testImage returns hue sweep from left to right, faded to black at the top and to white at the bottom
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		lightness := float64(y) / float64(height-1)
+		for x := 0; x < width; x++ {
+			r, g, b := hueColor(360 * float64(x) / float64(width))
+			if lightness < 0.5 {
+				r, g, b = r*lightness*2, g*lightness*2, b*lightness*2
+			} else {
+				k := (lightness - 0.5) * 2
+				r, g, b = r+(1-r)*k, g+(1-g)*k, b+(1-b)*k
+			}
+			img.SetRGBA(x, y, color.RGBA{R: uint8(r * 255), G: uint8(g * 255), B: uint8(b * 255), A: 255})
+		}
+	}
+	return img
+}
+
+// hueColor returns fully saturated color of hue 0..360, components are 0..1
+func hueColor(hue float64) (float64, float64, float64) {
+	h := hue / 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	switch int(h) {
+	case 0:
+		return 1, x, 0
+	case 1:
+		return x, 1, 0
+	case 2:
+		return 0, 1, x
+	case 3:
+		return 0, x, 1
+	case 4:
+		return x, 0, 1
+	default:
+		return 1, 0, x
+	}
+}
+
+// assertPreview checks that frame is the same as preview except for pixels changed by packing workaround:
+// byte 13 (CR) is sent as 12, so the last pixel of its group is printed black (red in BWR red plane)
+func assertPreview(t *testing.T, frame, preview image.Image, deviceMode string, imageData []byte) {
+	t.Helper()
+
+	width := preview.Bounds().Dx()
+	planeLength := len(imageData)
+	if deviceMode == DeviceModeBWR {
+		planeLength /= 2
+	}
+
+	replaced := 0
+	for y := 0; y < preview.Bounds().Dy(); y++ {
+		for x := 0; x < width; x++ {
+			r1, g1, b1, _ := frame.At(x, y).RGBA()
+			r2, g2, b2, _ := preview.At(x, y).RGBA()
+			if r1 == r2 && g1 == g2 && b1 == b2 {
+				continue
+			}
+
+			idx := y*width + x
+			var workaround bool
+			switch deviceMode {
+			case DeviceModeBWRY:
+				workaround = idx%4 == 3 && imageData[idx/4] == 12
+			case DeviceModeBWR:
+				workaround = idx%8 == 7 && (imageData[idx/8] == 12 || imageData[planeLength+idx/8] == 12)
+			default:
+				workaround = idx%8 == 7 && imageData[idx/8] == 12
+			}
+			if !workaround {
+				t.Fatalf("pixel (%d, %d) is %v, preview %v", x, y, frame.At(x, y), preview.At(x, y))
+			}
+			replaced++
+		}
+	}
+
+	t.Logf("%d pixels changed by CR workaround", replaced)
+}
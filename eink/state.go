@@ -0,0 +1,106 @@
+package eink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// frameState is the last frame sent to device, stored in state file by device name
+type frameState struct {
+	Hash       string    `json:"hash"`
+	Display    string    `json:"display"`
+	DeviceMode string    `json:"device_mode"`
+	Time       time.Time `json:"time"`
+}
+
+// frameHash identifies packed image data together with display and device mode
+func frameHash(display *DisplayProfile, deviceMode string, imageData []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(display.Name))
+	hash.Write([]byte{0})
+	hash.Write([]byte(deviceMode))
+	hash.Write([]byte{0})
+	hash.Write(imageData)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// loadFrameState returns the last frame sent to device, nil if there is none
+func loadFrameState(path, device string) (*frameState, error) {
+	var state *frameState
+	err := updateStateFile(path, func(states map[string]*frameState) bool {
+		state = states[device]
+		return false
+	})
+	return state, err
+}
+
+// saveFrameState stores the last frame sent to device, nil state removes it
+func saveFrameState(path, device string, state *frameState) error {
+	return updateStateFile(path, func(states map[string]*frameState) bool {
+		if state == nil {
+			delete(states, device)
+		} else {
+			states[device] = state
+		}
+		return true
+	})
+}
+
+// updateStateFile reads state file under file lock and writes it back if update returns true
+func updateStateFile(path string, update func(states map[string]*frameState) bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+		time.Sleep(lockRetryPause)
+	}
+	defer unlockFile(file)
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	states := map[string]*frameState{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &states); err != nil {
+			return fmt.Errorf("unable to parse state file %s: %w", path, err)
+		}
+	}
+
+	if !update(states) {
+		return nil
+	}
+
+	data, err = json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return nil
+}
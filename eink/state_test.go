@@ -0,0 +1,67 @@
+package eink
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFrameState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-eink", "state.json")
+
+	state, err := loadFrameState(path, "/dev/ttyUSB0")
+	if err != nil {
+		t.Fatalf("unable to load missing state: %s", err)
+	}
+	if state != nil {
+		t.Fatalf("state %v, expected none", state)
+	}
+
+	saved := &frameState{Hash: "abc", Display: DefaultDisplay, DeviceMode: DeviceModeBW, Time: time.Now().Round(time.Second)}
+	if err := saveFrameState(path, "/dev/ttyUSB0", saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveFrameState(path, "/dev/ttyUSB1", &frameState{Hash: "def"}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = loadFrameState(path, "/dev/ttyUSB0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.Hash != saved.Hash || state.DeviceMode != saved.DeviceMode || !state.Time.Equal(saved.Time) {
+		t.Fatalf("state %v, expected %v", state, saved)
+	}
+
+	if err := saveFrameState(path, "/dev/ttyUSB0", nil); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := loadFrameState(path, "/dev/ttyUSB0"); state != nil {
+		t.Fatalf("removed state %v is loaded", state)
+	}
+	if state, _ := loadFrameState(path, "/dev/ttyUSB1"); state == nil || state.Hash != "def" {
+		t.Fatalf("state of another device %v, expected hash def", state)
+	}
+}
+
+func TestFrameHash(t *testing.T) {
+	display := DisplayProfiles[0]
+	imageData := testImageData(display.FrameSize(DeviceModeBW))
+	hash := frameHash(display, DeviceModeBW, imageData)
+
+	if frameHash(display, DeviceModeBW, imageData) != hash {
+		t.Fatal("hash of the same frame differs")
+	}
+	if frameHash(display, DeviceModeBWR, imageData) == hash {
+		t.Fatal("hash does not depend on device mode")
+	}
+	if frameHash(DisplayProfiles[1], DeviceModeBW, imageData) == hash {
+		t.Fatal("hash does not depend on display")
+	}
+
+	changed := testImageData(len(imageData))
+	changed[0] ^= 1
+	if frameHash(display, DeviceModeBW, changed) == hash {
+		t.Fatal("hash does not depend on image data")
+	}
+}
@@ -0,0 +1,145 @@
+package eink
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// RFC 854 (telnet) and RFC 2217 (com port control) constants
+const (
+	telnetIAC  = 0xff
+	telnetDONT = 0xfe
+	telnetDO   = 0xfd
+	telnetWONT = 0xfc
+	telnetWILL = 0xfb
+	telnetSB   = 0xfa
+	telnetSE   = 0xf0
+
+	telnetOptionBinary  = 0x00
+	telnetOptionSGA     = 0x03
+	telnetOptionComPort = 0x2c
+
+	comPortSetBaudRate = 1
+	comPortSetDataSize = 2
+	comPortSetParity   = 3
+	comPortSetStopSize = 4
+	comPortSetControl  = 5
+	comPortPurgeData   = 12
+	comPortServerBase  = 100 //server responses are client command + 100
+
+	comPortParityNone       = 1
+	comPortStopSizeOne      = 1
+	comPortControlNoFlow    = 1
+	comPortControlRTSOn     = 11
+	comPortPurgeReceiveData = 1
+)
+
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateVerb
+	telnetStateSB
+	telnetStateSBIAC
+)
+
+// telnetDecoder separates data from telnet commands in a byte stream
+type telnetDecoder struct {
+	state int
+	verb  byte
+	sb    []byte
+
+	onCommand        func(verb, option byte)
+	onSubnegotiation func(data []byte)
+}
+
+func (d *telnetDecoder) decode(in []byte) []byte {
+	data := make([]byte, 0, len(in))
+
+	for _, c := range in {
+		switch d.state {
+		case telnetStateData:
+			if c == telnetIAC {
+				d.state = telnetStateIAC
+			} else {
+				data = append(data, c)
+			}
+
+		case telnetStateIAC:
+			switch c {
+			case telnetIAC:
+				data = append(data, c)
+				d.state = telnetStateData
+			case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+				d.verb = c
+				d.state = telnetStateVerb
+			case telnetSB:
+				d.sb = d.sb[:0]
+				d.state = telnetStateSB
+			default:
+				d.state = telnetStateData //NOP, GA, etc.
+			}
+
+		case telnetStateVerb:
+			if d.onCommand != nil {
+				d.onCommand(d.verb, c)
+			}
+			d.state = telnetStateData
+
+		case telnetStateSB:
+			if c == telnetIAC {
+				d.state = telnetStateSBIAC
+			} else {
+				d.sb = append(d.sb, c)
+			}
+
+		case telnetStateSBIAC:
+			switch c {
+			case telnetSE:
+				if d.onSubnegotiation != nil {
+					d.onSubnegotiation(append([]byte{}, d.sb...))
+				}
+				d.state = telnetStateData
+			case telnetIAC:
+				d.sb = append(d.sb, c)
+				d.state = telnetStateSB
+			default:
+				d.state = telnetStateSB
+			}
+		}
+	}
+
+	return data
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func telnetEscape(data []byte) []byte {
+	if bytes.IndexByte(data, telnetIAC) < 0 {
+		return data
+	}
+
+	escaped := make([]byte, 0, len(data)+16)
+	for _, c := range data {
+		escaped = append(escaped, c)
+		if c == telnetIAC {
+			escaped = append(escaped, telnetIAC)
+		}
+	}
+	return escaped
+}
+
+func telnetCommand(verb, option byte) []byte {
+	return []byte{telnetIAC, verb, option}
+}
+
+func comPortCommand(command byte, value ...byte) []byte {
+	request := []byte{telnetIAC, telnetSB, telnetOptionComPort, command}
+	request = append(request, telnetEscape(value)...)
+	return append(request, telnetIAC, telnetSE)
+}
+
+func comPortBaudRate(baudRate int) []byte {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, uint32(baudRate))
+	return comPortCommand(comPortSetBaudRate, value...)
+}
@@ -0,0 +1,58 @@
+package eink
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTelnetDecoder(t *testing.T) {
+	var stream []byte
+	stream = append(stream, 'a', telnetIAC, telnetIAC, 'b')
+	stream = append(stream, telnetCommand(telnetWILL, telnetOptionComPort)...)
+	stream = append(stream, 'c')
+	stream = append(stream, comPortCommand(comPortSetBaudRate, 0, 0, telnetIAC, 0)...)
+	stream = append(stream, telnetIAC, 0xf1, 'd') //NOP
+
+	expectedData := []byte{'a', telnetIAC, 'b', 'c', 'd'}
+	expectedSB := []byte{telnetOptionComPort, comPortSetBaudRate, 0, 0, telnetIAC, 0}
+
+	//the same result for stream split at any position
+	for _, size := range []int{len(stream), 1, 2, 3} {
+		var data, sb []byte
+		var commands [][2]byte
+		decoder := &telnetDecoder{
+			onCommand: func(verb, option byte) {
+				commands = append(commands, [2]byte{verb, option})
+			},
+			onSubnegotiation: func(payload []byte) {
+				sb = payload
+			},
+		}
+
+		for start := 0; start < len(stream); start += size {
+			data = append(data, decoder.decode(stream[start:min(len(stream), start+size)])...)
+		}
+
+		if !bytes.Equal(data, expectedData) {
+			t.Errorf("split %d: data %v, expected %v", size, data, expectedData)
+		}
+		if len(commands) != 1 || commands[0] != [2]byte{telnetWILL, telnetOptionComPort} {
+			t.Errorf("split %d: commands %v", size, commands)
+		}
+		if !bytes.Equal(sb, expectedSB) {
+			t.Errorf("split %d: subnegotiation %v, expected %v", size, sb, expectedSB)
+		}
+	}
+}
+
+func TestTelnetEscape(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	decoded := (&telnetDecoder{}).decode(telnetEscape(data))
+	if !bytes.Equal(decoded, data) {
+		t.Fatalf("decoded %v, expected %v", decoded, data)
+	}
+}
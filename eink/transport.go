@@ -0,0 +1,154 @@
+package eink
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.bug.st/serial"
+)
+
+var errTransportClosed = errors.New("transport is not open")
+
+// NoTimeout disables Transport read timeout
+const NoTimeout time.Duration = -1
+
+// Transport is a byte stream connected to the display driver board
+type Transport interface {
+	Open() error
+	Write(data []byte) (int, error)
+	Read(buf []byte) (int, error)
+	SetReadTimeout(timeout time.Duration) error //Read returns 0 bytes on timeout, NoTimeout blocks until data
+	Drain() error
+	ResetInputBuffer() error
+	ResetOutputBuffer() error
+	Close() error
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// SerialTransport is a Transport backed by local serial port
+type SerialTransport struct {
+	PortName string
+	Logger   log.FieldLogger //nil - standard logger
+
+	mu   sync.Mutex
+	port serial.Port
+}
+
+func NewSerialTransport(portName string) *SerialTransport {
+	return &SerialTransport{
+		PortName: portName,
+	}
+}
+
+func (t *SerialTransport) Open() error {
+	logger := t.logger()
+
+	logger.Debug("test port")
+	if err := testPort(t.PortName); err != nil {
+		return &PortError{PortName: t.PortName, Err: err}
+	}
+
+	logger.Debug("open port")
+	port, err := serial.Open(t.PortName, portMode())
+	if err != nil {
+		return &PortError{PortName: t.PortName, Err: err}
+	}
+
+	//setup port
+
+	logger.Debug("set port RTS")
+	if err := port.SetRTS(true); err != nil {
+		//pseudo-terminals (e.g. display simulator) do not support modem bits
+		logger.Warnf("unable to set RTS: %s", err)
+	}
+
+	logger.Debug("set port read timeout to unlimited")
+	if err := port.SetReadTimeout(NoTimeout); err != nil {
+		port.Close()
+		return fmt.Errorf("unable to set read timeout: %w", err)
+	}
+
+	t.mu.Lock()
+	t.port = port
+	t.mu.Unlock()
+
+	return nil
+}
+
+func (t *SerialTransport) Write(data []byte) (int, error) {
+	port := t.getPort()
+	if port == nil {
+		return 0, errTransportClosed
+	}
+	return port.Write(data)
+}
+
+func (t *SerialTransport) Read(buf []byte) (int, error) {
+	port := t.getPort()
+	if port == nil {
+		return 0, errTransportClosed
+	}
+	return port.Read(buf)
+}
+
+func (t *SerialTransport) SetReadTimeout(timeout time.Duration) error {
+	port := t.getPort()
+	if port == nil {
+		return errTransportClosed
+	}
+	return port.SetReadTimeout(timeout)
+}
+
+func (t *SerialTransport) Drain() error {
+	port := t.getPort()
+	if port == nil {
+		return errTransportClosed
+	}
+	return port.Drain()
+}
+
+func (t *SerialTransport) ResetInputBuffer() error {
+	port := t.getPort()
+	if port == nil {
+		return errTransportClosed
+	}
+	return port.ResetInputBuffer()
+}
+
+func (t *SerialTransport) ResetOutputBuffer() error {
+	port := t.getPort()
+	if port == nil {
+		return errTransportClosed
+	}
+	return port.ResetOutputBuffer()
+}
+
+// Close may be called concurrently with other operations to unblock them
+func (t *SerialTransport) Close() error {
+	t.mu.Lock()
+	port := t.port
+	t.port = nil
+	t.mu.Unlock()
+
+	if port == nil {
+		return nil
+	}
+	return port.Close()
+}
+
+func (t *SerialTransport) logger() log.FieldLogger {
+	if t.Logger == nil {
+		return log.StandardLogger()
+	}
+	return t.Logger
+}
+
+func (t *SerialTransport) getPort() serial.Port {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.port
+}
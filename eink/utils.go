@@ -6,13 +6,12 @@ import (
 	"strconv"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
 	"go.bug.st/serial"
 )
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func handshakeRequest(displayModel byte, deviceMode string) []byte {
+func handshakeRequest(width, height int, displayModel byte, deviceMode string) []byte {
 	var displayBWR byte = DisplayModeByteNone
 	var displayBWRY byte = DisplayModeByteNone
 
@@ -27,8 +26,8 @@ func handshakeRequest(displayModel byte, deviceMode string) []byte {
 	request[0] = 0xaa
 	request[1] = 0x55
 	request[2] = 0xe1
-	request[3] = ((ImageWidth * ImageHeight) / 8) / 256
-	request[4] = ((ImageWidth * ImageHeight) / 8) % 256
+	request[3] = byte(((width * height) / 8) / 256)
+	request[4] = byte(((width * height) / 8) % 256)
 	request[5] = displayBWRY
 	request[6] = displayModel
 	request[7] = displayBWR
@@ -48,20 +47,19 @@ func handshakeRequest(displayModel byte, deviceMode string) []byte {
 
 func validateHandshakeResponse(response []byte) error {
 	if len(response) != 10 {
-		return errors.New("wrong length")
+		return &HandshakeError{Err: ErrHandshakeLength, Offset: -1, Expected: 10, Actual: len(response)}
 	}
 
-	if response[0] != 0xa0 {
-		return errors.New("1-st byte mismatch")
-	}
-	if response[1] != 0x50 {
-		return errors.New("2-nd byte mismatch")
-	}
-	if response[2] != 0xf1 {
-		return errors.New("3-rd byte mismatch (connection)")
+	magic := map[int]byte{
+		0: 0xa0,
+		1: 0x50,
+		2: 0xf1, //connection
+		9: 0xff,
 	}
-	if response[9] != 0xff {
-		return errors.New("10-th byte mismatch (FF)")
+	for _, offset := range []int{0, 1, 2, 9} {
+		if response[offset] != magic[offset] {
+			return &HandshakeError{Err: ErrHandshakeMagic, Offset: offset, Expected: int(magic[offset]), Actual: int(response[offset])}
+		}
 	}
 
 	sum := 0
@@ -69,12 +67,53 @@ func validateHandshakeResponse(response []byte) error {
 		sum += int(response[i])
 	}
 	if response[8] != byte(sum%256) {
-		return errors.New("8-th byte mismatch (checksum)")
+		return &HandshakeError{Err: ErrHandshakeChecksum, Offset: 8, Expected: sum % 256, Actual: int(response[8])}
 	}
 
 	return nil
 }
 
+func validateHandshakeRequest(request []byte) error {
+	if len(request) != 12 {
+		return errors.New("wrong length")
+	}
+
+	if request[0] != 0xaa || request[1] != 0x55 || request[2] != 0xe1 {
+		return errors.New("header mismatch")
+	}
+	if request[9] != 0xff || request[10] != CR || request[11] != LF {
+		return errors.New("trailer mismatch")
+	}
+
+	sum := 0
+	for i := 0; i < 8; i++ {
+		sum += int(request[i])
+	}
+	if request[8] != byte(sum%256) {
+		return errors.New("checksum mismatch")
+	}
+
+	return nil
+}
+
+func handshakeResponse(request []byte) []byte {
+	response := make([]byte, 10)
+	response[0] = 0xa0
+	response[1] = 0x50
+	response[2] = 0xf1
+	copy(response[3:8], request[3:8])
+
+	sum := 0
+	for i := 0; i < 8; i++ {
+		sum += int(response[i])
+	}
+
+	response[8] = byte(sum % 256)
+	response[9] = 0xff
+
+	return response
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 func testPort(portName string) error {
@@ -97,21 +136,8 @@ func portMode() *serial.Mode {
 	}
 }
 
-func readPortData(port serial.Port) ([]byte, error) {
-	buf := make([]byte, 1024)
-
-	count, err := port.Read(buf)
-	if err != nil {
-		return nil, err
-	}
-
-	log.Debugf("read %d bytes: \"%s\"", count, printable(buf[:count]))
-
-	return buf[:count], nil
-}
-
-func writePortData(port serial.Port, data []byte) error {
-	if _, err := port.Write(data); err != nil {
+func writePortData(transport Transport, data []byte) error {
+	if _, err := transport.Write(data); err != nil {
 		return err
 	}
 	return nil
@@ -119,27 +145,15 @@ func writePortData(port serial.Port, data []byte) error {
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func imageDataValid(imageData []byte) bool {
-	return len(imageData) == (ImageHeight*ImageWidth)/8
-}
-
-func imageDataBWRValid(imageData []byte) bool {
-	return len(imageData) == (ImageHeight*ImageWidth)/4
-}
-
-func imageDataBWRYValid(imageData []byte) bool {
-	return len(imageData) == (ImageHeight*ImageWidth)/4
-}
-
 func extractReceivedBytes(data []byte) (int, error) {
 	parts := strings.Split(string(data), "=")
 	if len(parts) != 2 {
-		return 0, errors.New("malformed data")
+		return 0, fmt.Errorf("%w: %s", ErrMalformedOutput, printable(data))
 	}
 
 	bytesReceived, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return 0, fmt.Errorf("unable to read bytes data count: %s", err)
+		return 0, fmt.Errorf("%w: unable to read bytes data count: %w", ErrMalformedOutput, err)
 	}
 
 	return bytesReceived, nil
@@ -0,0 +1,71 @@
+package eink
+
+import (
+	"go-eink/images"
+	"image"
+	"math/rand"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// testPrinter returns printer with short pauses, without lock and state file
+func testPrinter(transport Transport, display *DisplayProfile, deviceMode string) *Printer {
+	printer := NewPrinter(transport)
+	printer.SetDisplay(display)
+	printer.DeviceMode = deviceMode
+	printer.WriteDataPause = 10 * time.Millisecond
+	printer.ScreenRefreshPause = time.Millisecond
+	printer.Lock = false
+	printer.Logger = log.New()
+	printer.Logger.(*log.Logger).SetLevel(log.WarnLevel)
+	return printer
+}
+
+// testImageData returns reproducible random frame
+func testImageData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+// assertFrame checks that frame received by simulator is the same as decoded image data
+func assertFrame(t *testing.T, frame image.Image, display *DisplayProfile, deviceMode string, imageData []byte) {
+	t.Helper()
+
+	if frame == nil {
+		t.Fatal("frame is not received")
+	}
+
+	var expected image.Image
+	switch deviceMode {
+	case DeviceModeBWR:
+		expected = images.FromImageDataBWR(imageData, display.Width, display.Height)
+	case DeviceModeBWRY:
+		expected = images.FromImageDataBWRY(imageData, display.Width, display.Height)
+	default:
+		expected = images.FromImageDataBW(imageData, display.Width, display.Height)
+	}
+
+	assertSameImage(t, frame, expected)
+}
+
+func assertSameImage(t *testing.T, actual, expected image.Image) {
+	t.Helper()
+
+	if actual.Bounds() != expected.Bounds() {
+		t.Fatalf("image bounds %v, expected %v", actual.Bounds(), expected.Bounds())
+	}
+
+	bounds := expected.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := actual.At(x, y).RGBA()
+			r2, g2, b2, _ := expected.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				t.Fatalf("pixel (%d, %d) is %v, expected %v", x, y, actual.At(x, y), expected.At(x, y))
+			}
+		}
+	}
+}
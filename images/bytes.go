@@ -191,3 +191,81 @@ func ToImageDataBWRY(blendMode BlendMode, imgBW, imgRW, imgYW image.Image) []byt
 
 	return output
 }
+
+///////////////////////////////////////////////////////////////////////////////
+
+func FromImageDataBW(imageData []byte, width, height int) image.Image {
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			idx := y*width + x
+			if idx/8 >= len(imageData) {
+				result.SetRGBA(x, y, colorWhite)
+				continue
+			}
+			if imageData[idx/8]&(0x80>>(idx%8)) != 0 {
+				result.SetRGBA(x, y, colorWhite)
+			} else {
+				result.SetRGBA(x, y, colorBlack)
+			}
+		}
+	}
+
+	return result
+}
+
+func FromImageDataBWR(imageData []byte, width, height int) image.Image {
+	planeLength := (width * height) / 8
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			idx := y*width + x
+			if planeLength+idx/8 >= len(imageData) {
+				result.SetRGBA(x, y, colorWhite)
+				continue
+			}
+			black := imageData[idx/8]&(0x80>>(idx%8)) == 0
+			red := imageData[planeLength+idx/8]&(0x80>>(idx%8)) == 0
+
+			switch {
+			case black:
+				result.SetRGBA(x, y, colorBlack)
+			case red:
+				result.SetRGBA(x, y, colorRed)
+			default:
+				result.SetRGBA(x, y, colorWhite)
+			}
+		}
+	}
+
+	return result
+}
+
+func FromImageDataBWRY(imageData []byte, width, height int) image.Image {
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			idx := y*width + x
+			if idx/4 >= len(imageData) {
+				result.SetRGBA(x, y, colorWhite)
+				continue
+			}
+
+			switch (imageData[idx/4] >> (6 - 2*(idx%4))) & 0b11 {
+			case BWRY_B:
+				result.SetRGBA(x, y, colorBlack)
+			case BWRY_R:
+				result.SetRGBA(x, y, colorRed)
+			case BWRY_Y:
+				result.SetRGBA(x, y, colorYellow)
+			default:
+				result.SetRGBA(x, y, colorWhite)
+			}
+		}
+	}
+
+	return result
+}
@@ -2,72 +2,123 @@ package images
 
 import (
 	"image"
-	"image/color"
 	"image/draw"
 	"math"
 )
 
 type DitheringMultipliers [][]float64
 
+// Dithering converts image to black and white with error diffusion,
+// kernel origin is in the middle column of the first multipliers row.
+// Only rows touched by kernel are kept in error buffer, result is *image.Gray with 0 and 255 values
 func Dithering(img image.Image, transformation PixelTransformation, multipliers DitheringMultipliers) image.Image {
-	result := image.NewRGBA(img.Bounds())
-	width := result.Bounds().Dx()
-	height := result.Bounds().Dy()
-	draw.Draw(result, result.Bounds(), img, image.Point{X: 0, Y: 0}, draw.Src)
-
-	var errors [][][]float64
-	for x := 0; x < width; x++ {
-		var values [][]float64
-		for y := 0; y < height; y++ {
-			values = append(values, []float64{0, 0, 0})
-		}
-		errors = append(errors, values)
+	return DitheringScan(img, transformation, multipliers, false)
+}
+
+// DitheringSerpentine is Dithering that scans odd rows right to left with mirrored kernel,
+// it removes directional artefacts of left to right scanning
+func DitheringSerpentine(img image.Image, transformation PixelTransformation, multipliers DitheringMultipliers) image.Image {
+	return DitheringScan(img, transformation, multipliers, true)
+}
+
+// DitheringScan is Dithering with selectable scan order
+func DitheringScan(img image.Image, transformation PixelTransformation, multipliers DitheringMultipliers, serpentine bool) image.Image {
+	src := ToRGBA(img)
+	width := src.Bounds().Dx()
+	height := src.Bounds().Dy()
+	result := image.NewGray(image.Rect(0, 0, width, height))
+
+	kernel := newDitheringKernel(multipliers)
+	threshold := transformation.GetThreshold()
+
+	//error is the same for all color components, single value per pixel is enough
+	rows := make([][]float32, max(1, len(multipliers)))
+	for i := range rows {
+		rows[i] = make([]float32, width)
 	}
 
 	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			c := result.RGBAAt(x, y)
+		errors := rows[y%len(rows)]
+		srcRow := src.Pix[y*src.Stride : y*src.Stride+width*4]
+		resultRow := result.Pix[y*result.Stride : y*result.Stride+width]
+
+		//odd rows of serpentine scan go right to left, kernel is mirrored
+		start, end, step, direction := 0, width, 1, 1
+		if serpentine && y%2 == 1 {
+			start, end, step, direction = width-1, -1, -1, -1
+		}
 
-			r := max(0, min(255, int(math.Ceil(float64(c.R)+errors[x][y][0]))))
-			g := max(0, min(255, int(math.Ceil(float64(c.G)+errors[x][y][1]))))
-			b := max(0, min(255, int(math.Ceil(float64(c.B)+errors[x][y][2]))))
+		for x := start; x != end; x += step {
+			e := errors[x]
+			r := clampColor(float32(srcRow[x*4]) + e)
+			g := clampColor(float32(srcRow[x*4+1]) + e)
+			b := clampColor(float32(srcRow[x*4+2]) + e)
 			gray := transformation.Transform(r, g, b)
 
-			transformedColor := 0.0
-			if gray < transformation.GetThreshold() {
-				result.Set(x, y, color.Black)
+			transformedColor := float32(0)
+			if gray < threshold {
+				resultRow[x] = 0
 			} else {
-				result.Set(x, y, color.White)
-				transformedColor = 255.0
+				resultRow[x] = 255
+				transformedColor = 255
 			}
 
-			redError := float64(gray) - transformedColor
-			greenError := float64(gray) - transformedColor
-			blueError := float64(gray) - transformedColor
-
-			for ky := 0; ky < len(multipliers); ky++ {
-				for kx := 0; kx < len(multipliers[ky]); kx++ {
-					nx := x + kx - 2
-					if nx < 0 || nx >= width {
-						continue
-					}
-
-					ny := y + ky
-					if ny < 0 || ny >= height {
-						continue
-					}
-
-					errors[nx][ny][0] += redError * multipliers[ky][kx]
-					errors[nx][ny][1] += greenError * multipliers[ky][kx]
-					errors[nx][ny][2] += blueError * multipliers[ky][kx]
+			diff := float32(gray) - transformedColor
+			for _, tap := range kernel {
+				nx := x + tap.dx*direction
+				ny := y + tap.dy
+				if nx < 0 || nx >= width || ny >= height {
+					continue
 				}
+				rows[ny%len(rows)][nx] += diff * tap.weight
 			}
 		}
+
+		//row is reused for y+len(rows)
+		clear(errors)
 	}
 
 	return result
 }
 
+// ToRGBA returns img itself if it is *image.RGBA starting at (0, 0), otherwise its copy
+func ToRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+	return result
+}
+
+type ditheringTap struct {
+	dx, dy int
+	weight float32
+}
+
+// newDitheringKernel lists non-zero multipliers relative to current pixel
+func newDitheringKernel(multipliers DitheringMultipliers) []ditheringTap {
+	var kernel []ditheringTap
+	for ky := range multipliers {
+		for kx := range multipliers[ky] {
+			if multipliers[ky][kx] == 0 {
+				continue
+			}
+			kernel = append(kernel, ditheringTap{
+				dx:     kx - 2,
+				dy:     ky,
+				weight: float32(multipliers[ky][kx]),
+			})
+		}
+	}
+	return kernel
+}
+
+func clampColor(v float32) int {
+	return max(0, min(255, int(math.Ceil(float64(v)))))
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 //multipliers
 
@@ -107,6 +158,25 @@ var DitheringSierra = [][]float64{
 	{0.0, 2.0 / 32.0, 3.0 / 32.0, 2.0 / 32.0, 0.0},
 }
 
+// DitheringFunc converts image to black and white with transformation
+type DitheringFunc func(img image.Image, transformation PixelTransformation) image.Image
+
+// GetDithering returns ordered dithering for threshold map names (see GetThresholdMap),
+// error diffusion for everything else (see GetDitheringAlgorithm).
+// Serpentine scan is used only by error diffusion, ordered dithering does not depend on scan order
+func GetDithering(name string, serpentine bool) DitheringFunc {
+	if thresholds, ok := GetThresholdMap(name); ok {
+		return func(img image.Image, transformation PixelTransformation) image.Image {
+			return OrderedDithering(img, transformation, thresholds)
+		}
+	}
+
+	multipliers := GetDitheringAlgorithm(name)
+	return func(img image.Image, transformation PixelTransformation) image.Image {
+		return DitheringScan(img, transformation, multipliers, serpentine)
+	}
+}
+
 func GetDitheringAlgorithm(name string) DitheringMultipliers {
 	switch name {
 	case "floyd_steinberg":
@@ -7,6 +7,7 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	"image/png"
+	"io"
 	"os"
 )
 
@@ -30,6 +31,11 @@ func Open(path string) (image.Image, error) {
 	}
 	defer reader.Close()
 
+	return Read(reader)
+}
+
+// Read decodes PNG, JPEG or GIF image
+func Read(reader io.Reader) (image.Image, error) {
 	img, _, err := image.Decode(reader)
 	if err != nil {
 		return nil, err
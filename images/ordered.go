@@ -0,0 +1,234 @@
+package images
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// ThresholdMap is a square matrix of thresholds 0..1 tiled over image
+type ThresholdMap struct {
+	Size   int
+	Values []float32
+}
+
+// OrderedDithering converts image to black and white comparing each pixel with threshold shifted by map value,
+// there is no error diffusion, so flat regions get stable regular pattern. Result is *image.Gray with 0 and 255 values.
+// Shifted threshold is clamped to 1..255, so 0 is always black and 255 is always white
+func OrderedDithering(img image.Image, transformation PixelTransformation, thresholds ThresholdMap) image.Image {
+	src := ToRGBA(img)
+	width := src.Bounds().Dx()
+	height := src.Bounds().Dy()
+	result := image.NewGray(image.Rect(0, 0, width, height))
+
+	threshold := float32(transformation.GetThreshold())
+
+	for y := 0; y < height; y++ {
+		srcRow := src.Pix[y*src.Stride : y*src.Stride+width*4]
+		resultRow := result.Pix[y*result.Stride : y*result.Stride+width]
+		mapRow := thresholds.Values[(y%thresholds.Size)*thresholds.Size:][:thresholds.Size]
+
+		for x := 0; x < width; x++ {
+			gray := transformation.Transform(int(srcRow[x*4]), int(srcRow[x*4+1]), int(srcRow[x*4+2]))
+			if float32(gray) < clampThreshold(threshold+(mapRow[x%thresholds.Size]-0.5)*255) {
+				resultRow[x] = 0
+			} else {
+				resultRow[x] = 255
+			}
+		}
+	}
+
+	return result
+}
+
+// clampThreshold keeps shifted threshold in 1..255
+func clampThreshold(v float32) float32 {
+	if v < 1 {
+		return 1
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+///////////////////////////////////////////////////////////////////////////////
+//threshold maps
+
+var (
+	ThresholdMapBayer2x2     = newBayerThresholdMap(2)
+	ThresholdMapBayer4x4     = newBayerThresholdMap(4)
+	ThresholdMapBayer8x8     = newBayerThresholdMap(8)
+	ThresholdMapClusteredDot = newClusteredDotThresholdMap(8)
+)
+
+// ThresholdMapBlueNoise is generated on first use, it takes some time
+var ThresholdMapBlueNoise = sync.OnceValue(func() ThresholdMap {
+	return newBlueNoiseThresholdMap(64, 1.5)
+})
+
+// GetThresholdMap returns map by ordered dithering algorithm name
+func GetThresholdMap(name string) (ThresholdMap, bool) {
+	switch name {
+	case "bayer_2x2":
+		return ThresholdMapBayer2x2, true
+	case "bayer_4x4":
+		return ThresholdMapBayer4x4, true
+	case "bayer_8x8":
+		return ThresholdMapBayer8x8, true
+	case "clustered_dot":
+		return ThresholdMapClusteredDot, true
+	case "blue_noise":
+		return ThresholdMapBlueNoise(), true
+	default:
+		return ThresholdMap{}, false
+	}
+}
+
+// newBayerThresholdMap builds recursive Bayer matrix, size is a power of 2
+func newBayerThresholdMap(size int) ThresholdMap {
+	ranks := []int{0}
+	for n := 1; n < size; n *= 2 {
+		next := make([]int, 4*n*n)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				v := 4 * ranks[y*n+x]
+				next[y*2*n+x] = v
+				next[y*2*n+x+n] = v + 2
+				next[(y+n)*2*n+x] = v + 3
+				next[(y+n)*2*n+x+n] = v + 1
+			}
+		}
+		ranks = next
+	}
+	return rankThresholdMap(size, ranks)
+}
+
+// newClusteredDotThresholdMap builds halftone screen with round dots growing from cell centers
+func newClusteredDotThresholdMap(size int) ThresholdMap {
+	spot := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			fx := 2 * math.Pi * (float64(x) + 0.5) / float64(size)
+			fy := 2 * math.Pi * (float64(y) + 0.5) / float64(size)
+			spot[y*size+x] = math.Cos(fx) + math.Cos(fy)
+		}
+	}
+
+	order := make([]int, size*size)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case spot[a] < spot[b]:
+			return -1
+		case spot[a] > spot[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	ranks := make([]int, size*size)
+	for rank, idx := range order {
+		ranks[idx] = rank
+	}
+	return rankThresholdMap(size, ranks)
+}
+
+// newBlueNoiseThresholdMap builds map with void-and-cluster method (Ulichney),
+// sigma is the width of gaussian filter used to find clusters and voids
+func newBlueNoiseThresholdMap(size int, sigma float64) ThresholdMap {
+	count := size * size
+
+	//toroidal gaussian filter by offset
+	filter := make([]float64, count)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			x := float64(min(dx, size-dx))
+			y := float64(min(dy, size-dy))
+			filter[dy*size+dx] = math.Exp(-(x*x + y*y) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := make([]bool, count)
+	energy := make([]float64, count)
+	set := func(idx int, value bool) {
+		pattern[idx] = value
+		sign := 1.0
+		if !value {
+			sign = -1.0
+		}
+		px, py := idx%size, idx/size
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				energy[y*size+x] += sign * filter[((y-py+size)%size)*size+(x-px+size)%size]
+			}
+		}
+	}
+	//tightest cluster is a set pixel with the highest energy, largest void is an unset one with the lowest
+	find := func(value bool) int {
+		best := -1
+		for idx := range pattern {
+			if pattern[idx] != value {
+				continue
+			}
+			if best < 0 || (value && energy[idx] > energy[best]) || (!value && energy[idx] < energy[best]) {
+				best = idx
+			}
+		}
+		return best
+	}
+
+	//initial pattern: random pixels moved from clusters to voids until stable
+	random := rand.New(rand.NewSource(1))
+	initial := count / 10
+	for _, idx := range random.Perm(count)[:initial] {
+		set(idx, true)
+	}
+	for {
+		cluster := find(true)
+		set(cluster, false)
+		void := find(false)
+		set(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	prototype := slices.Clone(pattern)
+	prototypeEnergy := slices.Clone(energy)
+
+	ranks := make([]int, count)
+
+	//ranks below initial: remove tightest clusters
+	for rank := initial - 1; rank >= 0; rank-- {
+		cluster := find(true)
+		set(cluster, false)
+		ranks[cluster] = rank
+	}
+
+	//ranks above initial: fill largest voids
+	copy(pattern, prototype)
+	copy(energy, prototypeEnergy)
+	for rank := initial; rank < count; rank++ {
+		void := find(false)
+		set(void, true)
+		ranks[void] = rank
+	}
+
+	return rankThresholdMap(size, ranks)
+}
+
+func rankThresholdMap(size int, ranks []int) ThresholdMap {
+	values := make([]float32, len(ranks))
+	for idx, rank := range ranks {
+		values[idx] = (float32(rank) + 0.5) / float32(len(ranks))
+	}
+	return ThresholdMap{
+		Size:   size,
+		Values: values,
+	}
+}
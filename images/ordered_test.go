@@ -0,0 +1,43 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// TestOrderedDitheringSolid checks that threshold shifted by map does not dither pure black and white
+func TestOrderedDitheringSolid(t *testing.T) {
+	transformations := map[string]PixelTransformation{
+		"gray 10":    &PixelTransformationGrayscale{Threshold: 10},
+		"gray 128":   &PixelTransformationGrayscale{Threshold: 128},
+		"gray 250":   &PixelTransformationGrayscale{Threshold: 250},
+		"red 128":    &PixelTransformationRed{Threshold: 128, RedHueThreshold: 25},
+		"yellow 180": &PixelTransformationYellow{Threshold: 180, YellowHueThreshold: 25},
+	}
+	colors := map[color.RGBA]uint8{
+		colorBlack: 0,
+		colorWhite: 255,
+	}
+
+	for _, name := range []string{"bayer_2x2", "bayer_4x4", "bayer_8x8", "clustered_dot", "blue_noise"} {
+		for transformationName, transformation := range transformations {
+			for c, expected := range colors {
+				if _, ok := transformation.(*PixelTransformationGrayscale); !ok && c == colorBlack {
+					continue //black is not red or yellow
+				}
+
+				img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+				draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+				result := GetDithering(name, false)(img, transformation).(*image.Gray)
+				for i, v := range result.Pix {
+					if v != expected {
+						t.Fatalf("%s, %s, color %v: pixel #%d is %d, expected %d", name, transformationName, c, i, v, expected)
+					}
+				}
+			}
+		}
+	}
+}
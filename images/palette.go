@@ -0,0 +1,452 @@
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// ink indexes in Palette and in pixels of paletted images
+const (
+	InkBlack = iota
+	InkWhite
+	InkRed
+	InkYellow
+)
+
+var (
+	InksBW   = []int{InkBlack, InkWhite}
+	InksBWR  = []int{InkBlack, InkWhite, InkRed}
+	InksBWRY = []int{InkBlack, InkWhite, InkRed, InkYellow}
+)
+
+// Palette holds colors of display inks indexed by InkBlack, InkWhite, InkRed, InkYellow
+type Palette [4]color.RGBA
+
+// DefaultPalette holds idealised ink colors, real panels are duller
+var DefaultPalette = Palette{colorBlack, colorWhite, colorRed, colorYellow}
+
+var inkNames = [...]string{"black", "white", "red", "yellow"}
+
+// paletteColor is ink color in palette file, either sRGB 0..255 or CIELAB (D65)
+type paletteColor struct {
+	SRGB *[3]float64 `json:"srgb"`
+	Lab  *Lab        `json:"lab"`
+}
+
+// ReadPalette reads JSON object with measured ink colors, inks missing in file are taken from base:
+//
+//	{"red": {"srgb": [160, 40, 35]}, "yellow": {"lab": [78, 2, 70]}}
+func ReadPalette(reader io.Reader, base Palette) (Palette, error) {
+	var colors map[string]paletteColor
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&colors); err != nil {
+		return base, err
+	}
+
+	palette := base
+	for name, value := range colors {
+		ink := -1
+		for i := range inkNames {
+			if inkNames[i] == name {
+				ink = i
+			}
+		}
+		if ink < 0 {
+			return base, fmt.Errorf("unknown ink: %s", name)
+		}
+
+		var r, g, b float64
+		switch {
+		case value.SRGB != nil && value.Lab == nil:
+			r, g, b = value.SRGB[0], value.SRGB[1], value.SRGB[2]
+			for _, v := range value.SRGB {
+				if v < 0 || v > 255 {
+					return base, fmt.Errorf("ink %s: srgb values must be 0..255", name)
+				}
+			}
+		case value.Lab != nil && value.SRGB == nil:
+			r, g, b = value.Lab.RGB()
+		default:
+			return base, fmt.Errorf("ink %s: one of srgb or lab is required", name)
+		}
+
+		palette[ink] = color.RGBA{
+			R: uint8(math.Round(r)),
+			G: uint8(math.Round(g)),
+			B: uint8(math.Round(b)),
+			A: 255,
+		}
+	}
+	return palette, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// PaletteDithering picks the nearest of inks in CIELAB for each pixel and diffuses
+// the whole RGB error vector, so colors between inks (orange, pink) are mixed from them.
+// Result pixels are ink indexes, its palette is a display palette
+func PaletteDithering(img image.Image, palette Palette, inks []int, multipliers DitheringMultipliers, distance ColorDistance, serpentine bool) *image.Paletted {
+	src := ToRGBA(img)
+	width := src.Bounds().Dx()
+	height := src.Bounds().Dy()
+	result := image.NewPaletted(image.Rect(0, 0, width, height), palette.colorPalette())
+
+	kernel := newDitheringKernel(multipliers)
+
+	inkColors := make([][3]float32, len(inks))
+	inkLab := make([]Lab, len(inks))
+	for i, ink := range inks {
+		c := palette[ink]
+		inkColors[i] = [3]float32{float32(c.R), float32(c.G), float32(c.B)}
+		inkLab[i] = RGBToLab(float64(c.R), float64(c.G), float64(c.B))
+	}
+
+	//r, g, b error of each pixel
+	rows := make([][]float32, max(1, len(multipliers)))
+	for i := range rows {
+		rows[i] = make([]float32, width*3)
+	}
+
+	for y := 0; y < height; y++ {
+		errors := rows[y%len(rows)]
+		srcRow := src.Pix[y*src.Stride : y*src.Stride+width*4]
+		resultRow := result.Pix[y*result.Stride : y*result.Stride+width]
+
+		start, end, step, direction := 0, width, 1, 1
+		if serpentine && y%2 == 1 {
+			start, end, step, direction = width-1, -1, -1, -1
+		}
+
+		for x := start; x != end; x += step {
+			var c [3]float32
+			for i := range c {
+				c[i] = clampFloat(float32(srcRow[x*4+i]) + errors[x*3+i])
+			}
+
+			lab := RGBToLab(float64(c[0]), float64(c[1]), float64(c[2]))
+			nearest := 0
+			nearestDistance := math.Inf(1)
+			for i := range inkLab {
+				if d := distance(lab, inkLab[i]); d < nearestDistance {
+					nearest = i
+					nearestDistance = d
+				}
+			}
+			resultRow[x] = uint8(inks[nearest])
+
+			var diff [3]float32
+			for i := range diff {
+				diff[i] = c[i] - inkColors[nearest][i]
+			}
+
+			for _, tap := range kernel {
+				nx := x + tap.dx*direction
+				ny := y + tap.dy
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+				row := rows[ny%len(rows)]
+				for i := range diff {
+					row[nx*3+i] += diff[i] * tap.weight
+				}
+			}
+		}
+
+		clear(errors)
+	}
+
+	return result
+}
+
+func clampFloat(v float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+func (p Palette) colorPalette() color.Palette {
+	colors := make(color.Palette, len(p))
+	for i := range p {
+		colors[i] = p[i]
+	}
+	return colors
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// ToImageDataPalettedBW packs image produced by PaletteDithering with InksBW like ToImageDataBW,
+// pixels are packed by ink index, so palettes with light black ink are printed correctly
+func ToImageDataPalettedBW(img *image.Paletted) []byte {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+
+	output := make([]byte, (width*height)/8)
+
+	for y := range height {
+		row := img.Pix[y*img.Stride : y*img.Stride+width]
+		for x, ink := range row {
+			idx := y*width + x
+			if idx/8 >= len(output) {
+				break
+			}
+			if ink != InkBlack {
+				output[idx/8] |= 0x80 >> (idx % 8)
+			}
+		}
+	}
+
+	return prepareImageDataBW(output)
+}
+
+// ToImageDataPalettedBWR packs image produced by PaletteDithering with InksBWR like ToImageDataBWR
+func ToImageDataPalettedBWR(img *image.Paletted) []byte {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+
+	imageDataBW := make([]byte, (width*height)/8)
+	imageDataRW := make([]byte, (width*height)/8)
+
+	for y := range height {
+		row := img.Pix[y*img.Stride : y*img.Stride+width]
+		for x, ink := range row {
+			idx := y*width + x
+			if idx/8 >= len(imageDataBW) {
+				break
+			}
+			if ink != InkBlack {
+				imageDataBW[idx/8] |= 0x80 >> (idx % 8)
+			}
+			if ink != InkRed {
+				imageDataRW[idx/8] |= 0x80 >> (idx % 8)
+			}
+		}
+	}
+
+	return prepareImageDataBWR(imageDataBW, imageDataRW)
+}
+
+// ToImageDataPalettedBWRY packs image produced by PaletteDithering with InksBWRY like ToImageDataBWRY
+func ToImageDataPalettedBWRY(img *image.Paletted) []byte {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+
+	output := make([]byte, (width*height)/4)
+
+	for y := range height {
+		row := img.Pix[y*img.Stride : y*img.Stride+width]
+		for x, ink := range row {
+			idx := y*width + x
+			if idx/4 >= len(output) {
+				break
+			}
+
+			var val byte
+			switch ink {
+			case InkBlack:
+				val = BWRY_B
+			case InkRed:
+				val = BWRY_R
+			case InkYellow:
+				val = BWRY_Y
+			default:
+				val = BWRY_W
+			}
+			output[idx/4] |= val << (6 - 2*(idx%4))
+		}
+	}
+
+	for i := range output {
+		if output[i] == 13 {
+			output[i] = 12
+		}
+	}
+
+	return output
+}
+
+///////////////////////////////////////////////////////////////////////////////
+//CIELAB, D65 white point
+
+// Lab is a color in CIELAB: L 0..100, a and b about -128..127
+type Lab [3]float64
+
+// RGBToLab converts sRGB 0..255 color
+func RGBToLab(r, g, b float64) Lab {
+	rl := srgbToLinear(r / 255)
+	gl := srgbToLinear(g / 255)
+	bl := srgbToLinear(b / 255)
+
+	x := (0.4124564*rl + 0.3575761*gl + 0.1804375*bl) / 0.95047
+	y := 0.2126729*rl + 0.7151522*gl + 0.0721750*bl
+	z := (0.0193339*rl + 0.1191920*gl + 0.9503041*bl) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return Lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// RGB converts color to sRGB 0..255, colors out of sRGB gamut are clipped
+func (c Lab) RGB() (r, g, b float64) {
+	fy := (c[0] + 16) / 116
+	fx := fy + c[1]/500
+	fz := fy - c[2]/200
+
+	x := labFInverse(fx) * 0.95047
+	y := labFInverse(fy)
+	z := labFInverse(fz) * 1.08883
+
+	rl := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	gl := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	bl := 0.0556434*x - 0.2040259*y + 1.0572252*z
+
+	return linearToSRGB(rl) * 255, linearToSRGB(gl) * 255, linearToSRGB(bl) * 255
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27.0*t + 16) / 116
+}
+
+func labFInverse(f float64) float64 {
+	if f*f*f > 216.0/24389.0 {
+		return f * f * f
+	}
+	return (116*f - 16) * 27.0 / 24389.0
+}
+
+///////////////////////////////////////////////////////////////////////////////
+//color difference
+
+// ColorDistance is a perceptual difference of two colors
+type ColorDistance func(a, b Lab) float64
+
+// GetColorDistance returns color difference formula by name, CIEDE2000 by default
+func GetColorDistance(name string) ColorDistance {
+	switch name {
+	case "cie76":
+		return DeltaE76
+	case "ciede2000":
+		return DeltaE2000
+	default:
+		return DeltaE2000
+	}
+}
+
+// DeltaE76 is euclidean distance in CIELAB, fast but overestimates difference of saturated colors
+func DeltaE76(a, b Lab) float64 {
+	dl := a[0] - b[0]
+	da := a[1] - b[1]
+	db := a[2] - b[2]
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// DeltaE2000 is CIEDE2000 color difference (kL = kC = kH = 1), it corrects CIELAB
+// non-uniformity in lightness, chroma and hue, especially for blues and saturated colors
+func DeltaE2000(a, b Lab) float64 {
+	l1, a1, b1 := a[0], a[1], a[2]
+	l2, a2, b2 := b[0], b[1], b[2]
+
+	c1 := math.Hypot(a1, b1)
+	c2 := math.Hypot(a2, b2)
+	cMean7 := math.Pow((c1+c2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cMean7/(cMean7+6103515625))) //25^7
+
+	a1p := a1 * (1 + g)
+	a2p := a2 * (1 + g)
+	c1p := math.Hypot(a1p, b1)
+	c2p := math.Hypot(a2p, b2)
+	h1p := hueAngle(b1, a1p)
+	h2p := hueAngle(b2, a2p)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+
+	var dhp float64
+	switch {
+	case c1p*c2p == 0:
+		dhp = 0
+	case math.Abs(h2p-h1p) <= 180:
+		dhp = h2p - h1p
+	case h2p-h1p > 180:
+		dhp = h2p - h1p - 360
+	default:
+		dhp = h2p - h1p + 360
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(degreesToRadians(dhp/2))
+
+	lMean := (l1 + l2) / 2
+	cMeanP := (c1p + c2p) / 2
+
+	var hMean float64
+	switch {
+	case c1p*c2p == 0:
+		hMean = h1p + h2p
+	case math.Abs(h1p-h2p) <= 180:
+		hMean = (h1p + h2p) / 2
+	case h1p+h2p < 360:
+		hMean = (h1p + h2p + 360) / 2
+	default:
+		hMean = (h1p + h2p - 360) / 2
+	}
+
+	t := 1 -
+		0.17*math.Cos(degreesToRadians(hMean-30)) +
+		0.24*math.Cos(degreesToRadians(2*hMean)) +
+		0.32*math.Cos(degreesToRadians(3*hMean+6)) -
+		0.20*math.Cos(degreesToRadians(4*hMean-63))
+
+	dTheta := 30 * math.Exp(-math.Pow((hMean-275)/25, 2))
+	cMeanP7 := math.Pow(cMeanP, 7)
+	rc := 2 * math.Sqrt(cMeanP7/(cMeanP7+6103515625))
+	lMean50 := (lMean - 50) * (lMean - 50)
+	sl := 1 + 0.015*lMean50/math.Sqrt(20+lMean50)
+	sc := 1 + 0.045*cMeanP
+	sh := 1 + 0.015*cMeanP*t
+	rt := -math.Sin(degreesToRadians(2*dTheta)) * rc
+
+	dl := dLp / sl
+	dc := dCp / sc
+	dh := dHp / sh
+	return math.Sqrt(dl*dl + dc*dc + dh*dh + rt*dc*dh)
+}
+
+// hueAngle returns atan2(y, x) in degrees 0..360
+func hueAngle(y, x float64) float64 {
+	if x == 0 && y == 0 {
+		return 0
+	}
+	h := math.Atan2(y, x) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,83 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestDeltaE2000 checks pairs from Sharma, Wu, Dalal "The CIEDE2000 Color-Difference Formula" test data
+func TestDeltaE2000(t *testing.T) {
+	tests := []struct {
+		a, b     Lab
+		expected float64
+	}{
+		{Lab{50, 2.6772, -79.7751}, Lab{50, 0, -82.7485}, 2.0425},
+		{Lab{50, 0, 0}, Lab{50, -1, 2}, 2.3669},
+		{Lab{50, 2.5, 0}, Lab{50, 0, -2.5}, 4.3065},
+		{Lab{50, 2.5, 0}, Lab{73, 25, -18}, 27.1492},
+		{Lab{60.2574, -34.0099, 36.2677}, Lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{Lab{22.7233, 20.0904, -46.6940}, Lab{23.0331, 14.9730, -42.5619}, 2.0373},
+		{Lab{2.0776, 0.0795, -1.1350}, Lab{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+
+	for _, test := range tests {
+		for _, d := range []float64{DeltaE2000(test.a, test.b), DeltaE2000(test.b, test.a)} {
+			if math.Abs(d-test.expected) > 0.0001 {
+				t.Errorf("DeltaE2000(%v, %v) = %.4f, expected %.4f", test.a, test.b, d, test.expected)
+			}
+		}
+	}
+}
+
+func TestLabRoundTrip(t *testing.T) {
+	for _, c := range [][3]float64{{0, 0, 0}, {255, 255, 255}, {150, 30, 35}, {205, 175, 15}, {10, 200, 90}} {
+		r, g, b := RGBToLab(c[0], c[1], c[2]).RGB()
+		if math.Abs(r-c[0]) > 0.01 || math.Abs(g-c[1]) > 0.01 || math.Abs(b-c[2]) > 0.01 {
+			t.Errorf("%v converted to %.2f, %.2f, %.2f", c, r, g, b)
+		}
+	}
+}
+
+func TestReadPalette(t *testing.T) {
+	palette, err := ReadPalette(strings.NewReader(`{"red": {"srgb": [150, 30, 35]}, "yellow": {"lab": [100, 0, 0]}}`), DefaultPalette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Palette{colorBlack, colorWhite, color.RGBA{R: 150, G: 30, B: 35, A: 255}, colorWhite}
+	if palette != expected {
+		t.Errorf("palette %v, expected %v", palette, expected)
+	}
+
+	for _, data := range []string{
+		`{"blue": {"srgb": [0, 0, 255]}}`,
+		`{"red": {}}`,
+		`{"red": {"srgb": [300, 0, 0]}}`,
+		`{"red": {"srgb": [255, 0, 0], "lab": [50, 0, 0]}}`,
+		`{"red": {"rgb": [255, 0, 0]}}`,
+	} {
+		if _, err := ReadPalette(strings.NewReader(data), DefaultPalette); err == nil {
+			t.Errorf("palette %s is accepted", data)
+		}
+	}
+}
+
+// TestToImageDataPalettedBW checks that pixels are packed by ink index, not by brightness of ink color
+func TestToImageDataPalettedBW(t *testing.T) {
+	palette := Palette{{R: 160, G: 160, B: 160, A: 255}, colorWhite, colorRed, colorYellow}
+	img := image.NewPaletted(image.Rect(0, 0, 16, 1), palette.colorPalette())
+	for x := range 16 {
+		if x%3 != 0 {
+			img.SetColorIndex(x, 0, InkWhite)
+		}
+	}
+
+	imageData := ToImageDataPalettedBW(img)
+	expected := []byte{0b01101101, 0b10110110}
+	if !bytes.Equal(imageData, expected) {
+		t.Errorf("image data %08b, expected %08b", imageData, expected)
+	}
+}
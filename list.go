@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-eink/eink"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+const (
+	FormatTable = "table"
+	FormatJson  = "json"
+)
+
+func listDevices(format string, probe bool) error {
+	devices, err := eink.EnumerateDevicesExtended(context.Background(), probe)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatJson:
+		return writeJson(os.Stdout, devices)
+	case FormatTable:
+		return writeDevicesTable(os.Stdout, devices)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func writeJson(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func writeDevicesTable(w io.Writer, devices []eink.DeviceInfo) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "NAME\tVID\tPID\tSERIAL\tPRODUCT\tKNOWN\tPROBE")
+	for _, device := range devices {
+		probe := device.Probe
+		if len(probe) == 0 {
+			probe = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			device.Name,
+			device.VID,
+			device.PID,
+			device.SerialNumber,
+			device.Product,
+			yesNo(device.Known),
+			probe,
+		)
+	}
+
+	return table.Flush()
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func printDeviceInfo(response *eink.HandshakeResponse, format string) error {
+	switch format {
+	case FormatJson:
+		return writeJson(os.Stdout, response)
+	case FormatTable:
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(table, "frame size\t%d\n", response.FrameSize)
+		fmt.Fprintf(table, "model\t0x%02x\n", response.Model)
+		fmt.Fprintf(table, "mode\t%s\n", response.Mode)
+		fmt.Fprintf(table, "echo\t%s\n", yesNo(response.Echo))
+		fmt.Fprintf(table, "payload\t%s\n", response.Payload)
+		fmt.Fprintf(table, "raw\t%s\n", response.Raw)
+		return table.Flush()
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
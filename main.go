@@ -1,70 +1,121 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"go-eink/eink"
 	"go-eink/images"
+	"image"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "bridge":
+			runBridge(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		}
+	}
+
 	verbose := flag.Bool("verbose", false, "show extended output")
 	list := flag.Bool("list", false, "show available devices and exit")
+	info := flag.Bool("info", false, "print -image and show device handshake information")
 	output := flag.String("output", "", "output result to file and exit")
+	format := flag.String("format", FormatTable, "output format for -list and -info, one of: table, json")
 
-	deviceName := flag.String("device", "", "device name, required, can be obtained with -list flag")
-	deviceMode := flag.String("device-mode", "bw", "device mode, one of: bw (black and white for IL075U, IL075RU), bwr (black, white and red for IL075RU), bwry (black, white, red and yellow for GDP075FU1)")
+	deviceName := flag.String("device", "", "device name, required, can be obtained with -list flag, auto - find device by known USB VID/PID, tcp://host:port - raw TCP serial bridge, rfc2217://host:port - RFC 2217 serial server")
+	deviceProbe := flag.Bool("device-probe", false, "check that auto detected or listed devices can be opened, nothing is sent to device")
+	displayName := flag.String("display", eink.DefaultDisplay, "display profile, one of: "+strings.Join(eink.DisplayProfileNames(), ", "))
+	displayModel := flag.String("display-model", "", "display model byte sent in handshake, e.g. 0xc4, overrides the one of -display profile, required for profiles with unknown model")
 
 	imagePath := flag.String("image", "", "path to image to print, required")
-	imageEnlarge := flag.Bool("image-enlarge", false, "enlarge image to fit screen")
-	imageAlign := flag.String("image-align", "middle", "image alignment, one of: top-left, top-middle, top-right, middle-left, middle, middle-right, bottom-left, bottom-middle, bottom-right")
-	imageBlendMode := flag.String("image-blend-mode", "BYR", "combination of letters {B, R, Y} defines order of blending result image from black, red, and yellow components, from top layer to bottom")
+	inkPalette := flag.String("ink-palette", "", "JSON file with ink colors measured on panel, used only with -image-palette, e.g. {\"red\": {\"srgb\": [150, 30, 35]}, \"yellow\": {\"lab\": [72, 2, 72]}}")
 
-	imageDitheringAlgorithm := flag.String("image-dithering-algo", "floyd_steinberg", "dithering algorithm for black and white, one of: floyd_steinberg, jarvis_judice_ninke, atkinson, burkes, stucki, sierra")
-	imageDitheringThreshold := flag.Int("image-dithering-threshold", 128, "dithering threshold, 0..256")
+	renderOptions := defaultRenderOptions()
+	renderOptions.bind(flag.CommandLine)
 
-	imageRedDitheringAlgorithm := flag.String("image-red-dithering-algo", "sierra", "dithering algorithm for red color, same values as -image-dithering-algo")
-	imageRedDitheringThreshold := flag.Int("image-red-dithering-threshold", 128, "red dithering threshold 0..256")
-	imageRedHueThreshold := flag.Int("image-red-hue-threshold", 25, "hue threshold for red image (degrees) 0..360")
+	printerOptions := defaultPrinterOptions()
+	printerOptions.bind(flag.CommandLine)
 
-	imageYellowDitheringAlgorithm := flag.String("image-yellow-dithering-algo", "stucki", "dithering algorithm for yellow color, same values as -image-dithering-algo")
-	imageYellowDitheringThreshold := flag.Int("image-yellow-dithering-threshold", 180, "yellow dithering threshold 0..256")
-	imageYellowHueThreshold := flag.Int("image-yellow-hue-threshold", 25, "hue threshold for yellow image (degrees) 0..360")
+	capturePath := flag.String("capture", "", "record all data sent to and received from device to file, see replay command")
 
-	einkWriteDataPause := flag.Int("eink-write-data-pause", 1000, "pause between image chunk writing (ms)")
-	einkScreenRefreshPause := flag.Int("eink-screen-refresh-pause", 5000, "pause for screen refresh (ms)")
-	einkReadDeviceOutput := flag.Bool("eink-read-device-output", false, "read data sent by device (NOTICE: in some cases output may be inconsistent)")
+	simulatorOutput := flag.String("simulator", "", "print to display simulator instead of device and save received frame to file")
+	simulatorPty := flag.Bool("simulator-pty", false, "run display simulator on pseudo-terminal (linux only) and wait for connections, frames are saved to -simulator file")
+	simulatorListen := flag.String("simulator-listen", "", "run display simulator on network address tcp://host:port or rfc2217://host:port and wait for connections, frames are saved to -simulator file")
 	flag.Parse()
 
 	//prepare logger
 
-	log.SetFormatter(&log.TextFormatter{
-		FullTimestamp: true,
-	})
-	log.SetOutput(os.Stdout)
-	if *verbose {
-		log.SetLevel(log.DebugLevel)
-	} else {
-		log.SetLevel(log.InfoLevel)
-	}
+	setupLogger(*verbose)
 
-	//prepare settings
+	//prepare display
 
-	eink.WriteDataPause = *einkWriteDataPause
-	eink.ScreenRefreshPause = *einkScreenRefreshPause
-	eink.ReadDeviceOutput = *einkReadDeviceOutput
+	display, err := selectDisplay(*displayName, *displayModel)
+	if err != nil {
+		log.Fatalf("unable to select display: %s", err)
+	}
 
 	//list devices
 
 	if *list {
-		eink.EnumerateDevicesExtended()
+		if err := listDevices(*format, *deviceProbe); err != nil {
+			log.Fatalf("unable to list devices: %s", err)
+		}
+		return
+	}
+
+	//prepare printer
+
+	if err := printerOptions.validate(); err != nil {
+		log.Fatalf("invalid printer options: %s", err)
+	}
+	deviceMode := renderOptions.DeviceMode
+	printer := printerOptions.newPrinter(display, deviceMode)
+	if bar := newProgressBar(); bar != nil {
+		printer.OnProgress = bar.Update
+	}
+
+	//device info is taken from print handshake, handshake alone leaves device waiting for frame
+
+	var handshake *eink.HandshakeResponse
+	if *info {
+		printer.OnHandshake = func(response *eink.HandshakeResponse) {
+			handshake = response
+		}
+		printer.Force = true
+	}
+
+	//simulator on pseudo-terminal or network
+
+	if *simulatorPty {
+		runSimulatorPty(display, *simulatorOutput)
+		return
+	}
+	if len(*simulatorListen) > 0 {
+		runSimulatorListen(display, *simulatorOutput, *simulatorListen)
 		return
 	}
 
 	//prepare image
 
+	if !display.SupportsMode(deviceMode) {
+		log.Fatalf("display %s does not support device mode %s: use -device-mode %s or select another display with -display",
+			display.Name, deviceMode, strings.Join(display.Modes, " or -device-mode "))
+	}
+
 	if len(*imagePath) == 0 {
 		log.Fatal("image required")
 	}
@@ -72,38 +123,19 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to open image: %s", err)
 	}
-	img = images.Resize(img, eink.ImageWidth, eink.ImageHeight, *imageEnlarge)
-	img = images.Align(img, eink.ImageWidth, eink.ImageHeight, images.GetAlign(*imageAlign))
-
-	transformBW := &images.PixelTransformationGrayscale{
-		Threshold: *imageDitheringThreshold,
-	}
-	imgBW := images.Dithering(img, transformBW, images.GetDitheringAlgorithm(*imageDitheringAlgorithm))
-
-	transformRW := &images.PixelTransformationRed{
-		Threshold:       *imageRedDitheringThreshold,
-		RedHueThreshold: *imageRedHueThreshold,
+	renderOptions.Inks, err = loadInks(display, *inkPalette)
+	if err != nil {
+		log.Fatalf("unable to load ink palette: %s", err)
 	}
-	imgRW := images.Dithering(img, transformRW, images.GetDitheringAlgorithm(*imageRedDitheringAlgorithm))
-
-	transformYW := &images.PixelTransformationYellow{
-		Threshold:          *imageYellowDitheringThreshold,
-		YellowHueThreshold: *imageYellowHueThreshold,
+	rendered, err := render(img, display, renderOptions)
+	if err != nil {
+		log.Fatalf("unable to prepare image: %s", err)
 	}
-	imgYW := images.Dithering(img, transformYW, images.GetDitheringAlgorithm(*imageYellowDitheringAlgorithm))
-
-	blendMode := images.StringToBlendMode(*imageBlendMode)
 
 	//output?
 
 	if len(*output) > 0 {
-		if *deviceMode == eink.DeviceModeBWR {
-			imgBW = images.JoinBWR(blendMode, imgBW, imgRW)
-		}
-		if *deviceMode == eink.DeviceModeBWRY {
-			imgBW = images.JoinBWRY(blendMode, imgBW, imgRW, imgYW)
-		}
-		if err := images.Save(imgBW, *output); err != nil {
+		if err := images.Save(rendered.Preview(), *output); err != nil {
 			log.Fatalf("unable to save image: %s", err)
 		}
 		return
@@ -111,26 +143,129 @@ func main() {
 
 	//print
 
-	if len(*deviceName) == 0 {
-		log.Fatal("device required")
+	imageData, err := rendered.ImageData()
+	if err != nil {
+		log.Fatalf("unable to prepare image: %s", err)
 	}
 
-	if *deviceMode == eink.DeviceModeBW {
-		imageDataBW := images.ToImageDataBW(imgBW)
-		if err := eink.PrintBW(*deviceName, imageDataBW); err != nil {
-			log.Fatalf("unable to print BW image: %s", err)
+	var simulator *eink.Simulator
+	if len(*simulatorOutput) > 0 {
+		simulator = eink.NewSimulator(display)
+		printer.Transport = simulator
+	} else {
+		printer.Transport = selectTransport(*deviceName, *deviceProbe)
+	}
+
+	if len(*capturePath) > 0 {
+		capture, err := os.Create(*capturePath)
+		if err != nil {
+			log.Fatalf("unable to create capture file: %s", err)
 		}
-	} else if *deviceMode == eink.DeviceModeBWR {
-		imageData := images.ToImageDataBWR(blendMode, imgBW, imgRW)
-		if err := eink.PrintBWR(*deviceName, imageData); err != nil {
-			log.Fatalf("unable to print BWR image: %s", err)
+		defer capture.Close()
+		printer.Transport = eink.NewRecordingTransport(printer.Transport, capture)
+	}
+
+	ctx, cancel := deviceContext(printerOptions.Timeout)
+	defer cancel()
+
+	if err := printer.PrintContext(ctx, imageData); err != nil {
+		log.Fatalf("unable to print %s image: %s", strings.ToUpper(deviceMode), err)
+	}
+
+	if simulator != nil {
+		if err := images.Save(simulator.Frame(), *simulatorOutput); err != nil {
+			log.Fatalf("unable to save simulator frame: %s", err)
+		}
+	}
+
+	if handshake != nil {
+		if err := printDeviceInfo(handshake, *format); err != nil {
+			log.Fatalf("unable to show device info: %s", err)
+		}
+	}
+}
+
+func runSimulatorPty(display *eink.DisplayProfile, output string) {
+	simulator := newSavingSimulator(display, output)
+
+	pty, err := eink.NewSimulatorPty(simulator)
+	if err != nil {
+		log.Fatalf("unable to start simulator: %s", err)
+	}
+	defer pty.Close()
+
+	log.Infof("simulator is listening on %s", pty.Name)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+}
+
+func runSimulatorListen(display *eink.DisplayProfile, output string, device string) {
+	address, rfc2217, ok := eink.ParseNetworkAddress(device)
+	if !ok {
+		log.Fatalf("unknown simulator address: %s, use tcp://host:port or rfc2217://host:port", device)
+	}
+
+	bridge := eink.NewBridge(newSavingSimulator(display, output), rfc2217)
+
+	log.Infof("simulator is listening on %s", device)
+
+	serveUntilSignal(bridge, address)
+}
+
+func newSavingSimulator(display *eink.DisplayProfile, output string) *eink.Simulator {
+	simulator := eink.NewSimulator(display)
+	simulator.OnFrame = func(frame image.Image) {
+		if len(output) == 0 {
+			return
 		}
-	} else if *deviceMode == eink.DeviceModeBWRY {
-		imageData := images.ToImageDataBWRY(blendMode, imgBW, imgRW, imgYW)
-		if err := eink.PrintBWRY(*deviceName, imageData); err != nil {
-			log.Fatalf("unable to print BWRY image: %s", err)
+		if err := images.Save(frame, output); err != nil {
+			log.Errorf("unable to save simulator frame: %s", err)
+		} else {
+			log.Infof("simulator frame saved to %s", output)
 		}
+	}
+	return simulator
+}
+
+func setupLogger(verbose bool) {
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
+	log.SetOutput(os.Stdout)
+	if verbose {
+		log.SetLevel(log.DebugLevel)
 	} else {
-		log.Fatalf("unknown device-mode: %s", *deviceMode)
+		log.SetLevel(log.InfoLevel)
+	}
+}
+
+func selectTransport(deviceName string, deviceProbe bool) eink.Transport {
+	if deviceName == eink.DeviceAuto {
+		name, err := eink.FindDevice(context.Background(), deviceProbe)
+		if err != nil {
+			log.Fatalf("unable to find device: %s", err)
+		}
+		log.Infof("found device: %s", name)
+		return eink.NewSerialTransport(name)
+	}
+	if len(deviceName) == 0 {
+		log.Fatal("device required")
+	}
+	return eink.NewTransport(deviceName)
+}
+
+// deviceContext is cancelled on interrupt or after timeout (ms)
+func deviceContext(timeout int) (context.Context, context.CancelFunc) {
+	ctx, cancelSignal := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, cancelSignal
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	return ctx, func() {
+		cancelTimeout()
+		cancelSignal()
 	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-eink/eink"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// printerOptions defines device communication, shared by print and serve commands
+type printerOptions struct {
+	WriteDataPause     int
+	ScreenRefreshPause int
+	ReadDeviceOutput   bool
+	FlowControl        string
+	RetryAttempts      int
+	RetryBackoff       int
+	Timeout            int
+	LockTimeout        int
+	StateFile          string
+	Force              bool
+}
+
+func defaultPrinterOptions() *printerOptions {
+	return &printerOptions{
+		FlowControl:   eink.FlowControlTimed,
+		RetryAttempts: 1,
+		RetryBackoff:  2000,
+		LockTimeout:   int(eink.DefaultLockTimeout / time.Millisecond),
+	}
+}
+
+// bind registers flags with current values as defaults
+func (o *printerOptions) bind(flags *flag.FlagSet) {
+	flags.IntVar(&o.WriteDataPause, "eink-write-data-pause", o.WriteDataPause, "pause between image chunk writing (ms), 0 - recommended for display")
+	flags.IntVar(&o.ScreenRefreshPause, "eink-screen-refresh-pause", o.ScreenRefreshPause, "pause for screen refresh (ms), 0 - recommended for display")
+	flags.BoolVar(&o.ReadDeviceOutput, "eink-read-device-output", o.ReadDeviceOutput, "read data sent by device (NOTICE: in some cases output may be inconsistent)")
+	flags.StringVar(&o.FlowControl, "eink-flow-control", o.FlowControl, "chunk flow control, one of: timed (pause after each chunk), ack (wait for device acknowledgement, pause if there is none)")
+	flags.IntVar(&o.RetryAttempts, "eink-retry-attempts", o.RetryAttempts, "number of print attempts, port is reopened and the whole image is sent again on failure")
+	flags.IntVar(&o.RetryBackoff, "eink-retry-backoff", o.RetryBackoff, "pause before the second print attempt (ms), doubled for each next attempt")
+	flags.IntVar(&o.Timeout, "eink-timeout", o.Timeout, "timeout for the whole device operation (ms), 0 - no timeout")
+	flags.IntVar(&o.LockTimeout, "lock-timeout", o.LockTimeout, "wait for device used by another go-eink process (ms), 0 - fail immediately")
+	flags.StringVar(&o.StateFile, "state-file", o.StateFile, "file with frames sent to devices, unchanged frame is not printed again, default - go-eink/state.json in user cache directory, none - disabled")
+	flags.BoolVar(&o.Force, "force", o.Force, "print frame even if it has not changed")
+}
+
+// selectDisplay returns display profile, model byte (e.g. 0xc4) overrides the one of profile
+func selectDisplay(name, model string) (*eink.DisplayProfile, error) {
+	display, err := eink.GetDisplayProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(model) == 0 {
+		return display, nil
+	}
+
+	value, err := strconv.ParseUint(model, 0, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid display model %s: %w", model, err)
+	}
+	override := *display
+	override.Model = byte(value)
+	return &override, nil
+}
+
+// validate checks values of flags
+func (o *printerOptions) validate() error {
+	return eink.CheckFlowControl(o.FlowControl)
+}
+
+// newPrinter returns printer for display without transport
+func (o *printerOptions) newPrinter(display *eink.DisplayProfile, deviceMode string) *eink.Printer {
+	printer := eink.NewPrinter(nil)
+	printer.DeviceMode = deviceMode
+	printer.SetDisplay(display)
+	if o.WriteDataPause > 0 {
+		printer.WriteDataPause = time.Duration(o.WriteDataPause) * time.Millisecond
+	}
+	if o.ScreenRefreshPause > 0 {
+		printer.ScreenRefreshPause = time.Duration(o.ScreenRefreshPause) * time.Millisecond
+	}
+	printer.ReadDeviceOutput = o.ReadDeviceOutput
+	printer.FlowControl = o.FlowControl
+	printer.Retry = eink.RetryPolicy{
+		Attempts: o.RetryAttempts,
+		Backoff:  time.Duration(o.RetryBackoff) * time.Millisecond,
+	}
+	printer.LockTimeout = time.Duration(o.LockTimeout) * time.Millisecond
+	printer.StateFile = o.stateFile()
+	printer.Force = o.Force
+	return printer
+}
+
+// stateFile resolves -state-file flag value to path, empty if disabled
+func (o *printerOptions) stateFile() string {
+	switch o.StateFile {
+	case "none":
+		return ""
+	case "":
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			log.Warnf("unable to locate user cache directory, state file disabled: %s", err)
+			return ""
+		}
+		return filepath.Join(dir, "go-eink", "state.json")
+	default:
+		return o.StateFile
+	}
+}
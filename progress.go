@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"go-eink/eink"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+type progressBar struct {
+	output    io.Writer
+	uploading bool
+}
+
+// newProgressBar returns nil when stdout is not a terminal
+func newProgressBar() *progressBar {
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progressBar{
+		output: os.Stdout,
+	}
+}
+
+func (b *progressBar) Update(progress eink.Progress) {
+	if progress.Phase != eink.PhaseUpload {
+		if b.uploading {
+			fmt.Fprintln(b.output)
+			b.uploading = false
+		}
+		return
+	}
+
+	b.uploading = true
+
+	filled := 0
+	if progress.BytesTotal > 0 {
+		filled = progressBarWidth * progress.BytesSent / progress.BytesTotal
+	}
+
+	fmt.Fprintf(b.output, "\r\033[K[%s%s] chunk %d/%d, %d/%d bytes, ~%s left",
+		strings.Repeat("#", filled),
+		strings.Repeat(".", progressBarWidth-filled),
+		progress.Chunk,
+		progress.Chunks,
+		progress.BytesSent,
+		progress.BytesTotal,
+		progress.Remaining.Round(time.Second),
+	)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-eink/eink"
+	"go-eink/images"
+	"image"
+	"os"
+	"sync"
+)
+
+// renderOptions defines how source image is prepared for device mode, shared by print and serve commands
+type renderOptions struct {
+	DeviceMode string
+
+	Enlarge   bool
+	Align     string
+	BlendMode string
+
+	DitheringAlgorithm  string
+	DitheringThreshold  int
+	DitheringSerpentine bool
+	Palette             bool
+	ColorDistance       string
+	Inks                images.Palette //set from display profile and -ink-palette file, not a flag
+
+	RedDitheringAlgorithm string
+	RedDitheringThreshold int
+	RedHueThreshold       int
+
+	YellowDitheringAlgorithm string
+	YellowDitheringThreshold int
+	YellowHueThreshold       int
+}
+
+func defaultRenderOptions() *renderOptions {
+	return &renderOptions{
+		DeviceMode:               eink.DeviceModeBW,
+		Align:                    "middle",
+		BlendMode:                "BYR",
+		DitheringAlgorithm:       "floyd_steinberg",
+		DitheringThreshold:       128,
+		ColorDistance:            "ciede2000",
+		RedDitheringAlgorithm:    "sierra",
+		RedDitheringThreshold:    128,
+		RedHueThreshold:          25,
+		YellowDitheringAlgorithm: "stucki",
+		YellowDitheringThreshold: 180,
+		YellowHueThreshold:       25,
+	}
+}
+
+// bind registers flags with current values as defaults
+func (o *renderOptions) bind(flags *flag.FlagSet) {
+	flags.StringVar(&o.DeviceMode, "device-mode", o.DeviceMode, "device mode, one of: bw (black and white for IL075U, IL075RU), bwr (black, white and red for IL075RU), bwry (black, white, red and yellow for GDP075FU1), must be supported by -display")
+
+	flags.BoolVar(&o.Enlarge, "image-enlarge", o.Enlarge, "enlarge image to fit screen")
+	flags.StringVar(&o.Align, "image-align", o.Align, "image alignment, one of: top-left, top-middle, top-right, middle-left, middle, middle-right, bottom-left, bottom-middle, bottom-right")
+	flags.StringVar(&o.BlendMode, "image-blend-mode", o.BlendMode, "combination of letters {B, R, Y} defines order of blending result image from black, red, and yellow components, from top layer to bottom")
+
+	flags.StringVar(&o.DitheringAlgorithm, "image-dithering-algo", o.DitheringAlgorithm, "dithering algorithm for black and white, one of: floyd_steinberg, jarvis_judice_ninke, atkinson, burkes, stucki, sierra (error diffusion), bayer_2x2, bayer_4x4, bayer_8x8, clustered_dot, blue_noise (ordered)")
+	flags.IntVar(&o.DitheringThreshold, "image-dithering-threshold", o.DitheringThreshold, "dithering threshold, 0..256")
+	flags.BoolVar(&o.Palette, "image-palette", o.Palette, "dither all colors at once, the nearest display color is selected for each pixel and color error is diffused, uses -image-dithering-algo (error diffusion only), other color flags are ignored")
+	flags.StringVar(&o.ColorDistance, "image-color-distance", o.ColorDistance, "color difference used to select the nearest ink, used only with -image-palette, one of: ciede2000 (accurate), cie76 (fast)")
+	flags.BoolVar(&o.DitheringSerpentine, "image-dithering-serpentine", o.DitheringSerpentine, "scan odd rows right to left with mirrored kernel, reduces directional artefacts of error diffusion, used for all colors")
+
+	flags.StringVar(&o.RedDitheringAlgorithm, "image-red-dithering-algo", o.RedDitheringAlgorithm, "dithering algorithm for red color, same values as -image-dithering-algo")
+	flags.IntVar(&o.RedDitheringThreshold, "image-red-dithering-threshold", o.RedDitheringThreshold, "red dithering threshold 0..256")
+	flags.IntVar(&o.RedHueThreshold, "image-red-hue-threshold", o.RedHueThreshold, "hue threshold for red image (degrees) 0..360")
+
+	flags.StringVar(&o.YellowDitheringAlgorithm, "image-yellow-dithering-algo", o.YellowDitheringAlgorithm, "dithering algorithm for yellow color, same values as -image-dithering-algo")
+	flags.IntVar(&o.YellowDitheringThreshold, "image-yellow-dithering-threshold", o.YellowDitheringThreshold, "yellow dithering threshold 0..256")
+	flags.IntVar(&o.YellowHueThreshold, "image-yellow-hue-threshold", o.YellowHueThreshold, "hue threshold for yellow image (degrees) 0..360")
+}
+
+// loadInks returns ink colors of display, overridden by colors from palette file if path is not empty
+func loadInks(display *eink.DisplayProfile, path string) (images.Palette, error) {
+	inks := display.InkPalette()
+	if len(path) == 0 {
+		return inks, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return inks, err
+	}
+	defer file.Close()
+
+	inks, err = images.ReadPalette(file, inks)
+	if err != nil {
+		return inks, fmt.Errorf("unable to read palette file %s: %w", path, err)
+	}
+	return inks, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// renderedImage holds dithered black, red and yellow components, only those used by device mode,
+// or image of display colors in palette mode
+type renderedImage struct {
+	deviceMode string
+	blendMode  images.BlendMode
+	bw, rw, yw image.Image
+	paletted   *image.Paletted
+}
+
+// render resizes, aligns and dithers image for display,
+// black, red and yellow components required by device mode are dithered concurrently
+func render(img image.Image, display *eink.DisplayProfile, options *renderOptions) (*renderedImage, error) {
+	img = images.Resize(img, display.Width, display.Height, options.Enlarge)
+	img = images.ToRGBA(images.Align(img, display.Width, display.Height, images.GetAlign(options.Align)))
+
+	rendered := &renderedImage{
+		deviceMode: options.DeviceMode,
+		blendMode:  images.StringToBlendMode(options.BlendMode),
+	}
+
+	if options.Palette {
+		if _, ordered := images.GetThresholdMap(options.DitheringAlgorithm); ordered {
+			return nil, fmt.Errorf("palette dithering supports only error diffusion, got %s", options.DitheringAlgorithm)
+		}
+
+		inks := images.InksBW
+		switch options.DeviceMode {
+		case eink.DeviceModeBWR:
+			inks = images.InksBWR
+		case eink.DeviceModeBWRY:
+			inks = images.InksBWRY
+		}
+
+		multipliers := images.GetDitheringAlgorithm(options.DitheringAlgorithm)
+		distance := images.GetColorDistance(options.ColorDistance)
+		rendered.paletted = images.PaletteDithering(img, options.Inks, inks, multipliers, distance, options.DitheringSerpentine)
+		return rendered, nil
+	}
+
+	wg := sync.WaitGroup{}
+	dither := func(result *image.Image, transformation images.PixelTransformation, algorithm string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			*result = images.GetDithering(algorithm, options.DitheringSerpentine)(img, transformation)
+		}()
+	}
+
+	transformBW := &images.PixelTransformationGrayscale{
+		Threshold: options.DitheringThreshold,
+	}
+	dither(&rendered.bw, transformBW, options.DitheringAlgorithm)
+
+	if options.DeviceMode == eink.DeviceModeBWR || options.DeviceMode == eink.DeviceModeBWRY {
+		transformRW := &images.PixelTransformationRed{
+			Threshold:       options.RedDitheringThreshold,
+			RedHueThreshold: options.RedHueThreshold,
+		}
+		dither(&rendered.rw, transformRW, options.RedDitheringAlgorithm)
+	}
+
+	if options.DeviceMode == eink.DeviceModeBWRY {
+		transformYW := &images.PixelTransformationYellow{
+			Threshold:          options.YellowDitheringThreshold,
+			YellowHueThreshold: options.YellowHueThreshold,
+		}
+		dither(&rendered.yw, transformYW, options.YellowDitheringAlgorithm)
+	}
+
+	wg.Wait()
+
+	return rendered, nil
+}
+
+// Preview returns image as it will be shown on display
+func (r *renderedImage) Preview() image.Image {
+	if r.paletted != nil {
+		return r.paletted
+	}
+
+	switch r.deviceMode {
+	case eink.DeviceModeBWR:
+		return images.JoinBWR(r.blendMode, r.bw, r.rw)
+	case eink.DeviceModeBWRY:
+		return images.JoinBWRY(r.blendMode, r.bw, r.rw, r.yw)
+	default:
+		return r.bw
+	}
+}
+
+// ImageData returns image packed for device mode
+func (r *renderedImage) ImageData() ([]byte, error) {
+	if r.paletted != nil {
+		switch r.deviceMode {
+		case eink.DeviceModeBW:
+			return images.ToImageDataPalettedBW(r.paletted), nil
+		case eink.DeviceModeBWR:
+			return images.ToImageDataPalettedBWR(r.paletted), nil
+		case eink.DeviceModeBWRY:
+			return images.ToImageDataPalettedBWRY(r.paletted), nil
+		}
+	}
+
+	switch r.deviceMode {
+	case eink.DeviceModeBW:
+		return images.ToImageDataBW(r.bw), nil
+	case eink.DeviceModeBWR:
+		return images.ToImageDataBWR(r.blendMode, r.bw, r.rw), nil
+	case eink.DeviceModeBWRY:
+		return images.ToImageDataBWRY(r.blendMode, r.bw, r.rw, r.yw), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", eink.ErrUnknownDeviceMode, r.deviceMode)
+	}
+}
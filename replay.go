@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"go-eink/eink"
+	"go-eink/images"
+	"image"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runReplay feeds capture recorded with -capture flag into display simulator
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	verbose := flags.Bool("verbose", false, "show extended output")
+	capturePath := flags.String("capture", "", "path to capture file, required")
+	output := flags.String("output", "", "save the last frame received by simulator to file")
+	displayName := flags.String("display", eink.DefaultDisplay, "display profile, one of: "+strings.Join(eink.DisplayProfileNames(), ", "))
+	flags.Parse(args)
+
+	setupLogger(*verbose)
+
+	display, err := eink.GetDisplayProfile(*displayName)
+	if err != nil {
+		log.Fatalf("unable to select display: %s", err)
+	}
+
+	if len(*capturePath) == 0 {
+		log.Fatal("capture required")
+	}
+	file, err := os.Open(*capturePath)
+	if err != nil {
+		log.Fatalf("unable to open capture: %s", err)
+	}
+	records, err := eink.ReadCapture(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("unable to read capture: %s", err)
+	}
+
+	bytesWritten := 0
+	bytesRead := 0
+	for _, record := range records {
+		switch record.Direction {
+		case eink.CaptureWrite:
+			bytesWritten += len(record.Data)
+		case eink.CaptureRead:
+			bytesRead += len(record.Data)
+			log.Debugf("%s device: \"%s\"", record.Time.Format("15:04:05.000"), record.Text)
+		}
+	}
+	log.Infof("capture: %d records, %d bytes written, %d bytes read", len(records), bytesWritten, bytesRead)
+
+	var frames []image.Image
+	simulator := eink.NewSimulator(display)
+	simulator.OnFrame = func(frame image.Image) {
+		frames = append(frames, frame)
+	}
+
+	if err := eink.ReplayCapture(records, simulator); err != nil {
+		log.Fatalf("unable to replay capture: %s", err)
+	}
+
+	log.Infof("frames received: %d", len(frames))
+	if len(frames) == 0 {
+		log.Fatal("capture does not contain complete frame")
+	}
+
+	if len(*output) > 0 {
+		if err := images.Save(frames[len(frames)-1], *output); err != nil {
+			log.Fatalf("unable to save frame: %s", err)
+		}
+	}
+}
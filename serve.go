@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-eink/eink"
+	"go-eink/images"
+	"image"
+	"image/png"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	serveMaxUploadSize = 32 << 20
+	serveShutdownWait  = 10 * time.Second
+)
+
+// runServe starts HTTP server printing uploaded images
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	verbose := flags.Bool("verbose", false, "show extended output")
+	listen := flags.String("listen", ":8080", "HTTP server address")
+	deviceName := flags.String("device", "", "device name, required, auto - find device by known USB VID/PID, tcp://host:port - raw TCP serial bridge, rfc2217://host:port - RFC 2217 serial server")
+	deviceProbe := flags.Bool("device-probe", false, "check that auto detected device can be opened, nothing is sent to device")
+	displayName := flags.String("display", eink.DefaultDisplay, "display profile, one of: "+strings.Join(eink.DisplayProfileNames(), ", "))
+	displayModel := flags.String("display-model", "", "display model byte sent in handshake, e.g. 0xc4, overrides the one of -display profile, required for profiles with unknown model")
+	simulatorOutput := flags.String("simulator", "", "print to display simulator instead of device and save received frames to file")
+	inkPalette := flags.String("ink-palette", "", "JSON file with ink colors measured on panel, used only with -image-palette, e.g. {\"red\": {\"srgb\": [150, 30, 35]}, \"yellow\": {\"lab\": [72, 2, 72]}}")
+	noCoalesce := flags.Bool("no-coalesce", false, "print every queued job, by default waiting job is replaced by newer one")
+
+	renderOptions := defaultRenderOptions()
+	renderOptions.bind(flags)
+
+	printerOptions := defaultPrinterOptions()
+	printerOptions.bind(flags)
+
+	flags.Parse(args)
+
+	setupLogger(*verbose)
+
+	if err := printerOptions.validate(); err != nil {
+		log.Fatalf("invalid printer options: %s", err)
+	}
+
+	display, err := selectDisplay(*displayName, *displayModel)
+	if err != nil {
+		log.Fatalf("unable to select display: %s", err)
+	}
+	if !display.SupportsMode(renderOptions.DeviceMode) {
+		log.Fatalf("display %s does not support device mode %s", display.Name, renderOptions.DeviceMode)
+	}
+	renderOptions.Inks, err = loadInks(display, *inkPalette)
+	if err != nil {
+		log.Fatalf("unable to load ink palette: %s", err)
+	}
+
+	var transport eink.Transport
+	if len(*simulatorOutput) > 0 {
+		transport = newSavingSimulator(display, *simulatorOutput)
+		*deviceName = "simulator"
+	} else {
+		transport = selectTransport(*deviceName, *deviceProbe)
+	}
+
+	queue := eink.NewQueue()
+	queue.Coalesce = !*noCoalesce
+	queue.Timeout = time.Duration(printerOptions.Timeout) * time.Millisecond
+	defer queue.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	s := &server{
+		device:         *deviceName,
+		display:        display,
+		transport:      transport,
+		renderOptions:  renderOptions,
+		printerOptions: printerOptions,
+		queue:          queue,
+	}
+
+	httpServer := &http.Server{
+		Addr:    *listen,
+		Handler: s.handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), serveShutdownWait)
+		defer cancelShutdown()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("server is listening on %s", *listen)
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("unable to start server: %s", err)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type server struct {
+	device         string
+	display        *eink.DisplayProfile
+	transport      eink.Transport
+	renderOptions  *renderOptions  //defaults for requests
+	printerOptions *printerOptions //shared by all jobs
+	queue          *eink.Queue
+}
+
+type displayResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	Modes       []string `json:"modes"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// handler routes API requests:
+// GET /api/display - display profile,
+// POST /api/preview - dithered image PNG,
+// POST /api/print - enqueue print job,
+// GET /api/jobs - queued, running and recently finished jobs,
+// GET /api/jobs/{id} - job status.
+// Image is uploaded as multipart "image" field or as request body,
+// render options are passed as query or form parameters named after command line flags
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/display", s.handleDisplay)
+	mux.HandleFunc("POST /api/preview", s.handlePreview)
+	mux.HandleFunc("POST /api/print", s.handlePrint)
+	mux.HandleFunc("GET /api/jobs", s.handleJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleJob)
+	return mux
+}
+
+func (s *server) handleDisplay(w http.ResponseWriter, r *http.Request) {
+	writeJsonResponse(w, http.StatusOK, &displayResponse{
+		Name:        s.display.Name,
+		Description: s.display.Description,
+		Width:       s.display.Width,
+		Height:      s.display.Height,
+		Modes:       s.display.Modes,
+	})
+}
+
+func (s *server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	rendered, err := s.renderRequest(w, r)
+	if err != nil {
+		writeJsonResponse(w, http.StatusBadRequest, &errorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, rendered.Preview()); err != nil {
+		log.Warnf("unable to send preview: %s", err)
+	}
+}
+
+func (s *server) handlePrint(w http.ResponseWriter, r *http.Request) {
+	rendered, err := s.renderRequest(w, r)
+	if err != nil {
+		writeJsonResponse(w, http.StatusBadRequest, &errorResponse{Error: err.Error()})
+		return
+	}
+	imageData, err := rendered.ImageData()
+	if err != nil {
+		writeJsonResponse(w, http.StatusBadRequest, &errorResponse{Error: err.Error()})
+		return
+	}
+
+	printer := s.printerOptions.newPrinter(s.display, rendered.deviceMode)
+	printer.Transport = s.transport
+
+	job := s.queue.Submit(s.device, printer, imageData)
+	log.Infof("print job #%d queued (%s)", job.ID, job.DeviceMode)
+
+	go func() {
+		if err := job.Wait(context.Background()); errors.Is(err, eink.ErrJobSuperseded) {
+			log.Infof("print job #%d skipped: %s", job.ID, err)
+		} else if err != nil {
+			log.Errorf("print job #%d failed: %s", job.ID, err)
+		} else {
+			log.Infof("print job #%d done", job.ID)
+		}
+	}()
+
+	writeJsonResponse(w, http.StatusAccepted, job.Status())
+}
+
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	statuses := []eink.JobStatus{}
+	for _, job := range s.queue.Jobs() {
+		statuses = append(statuses, job.Status())
+	}
+	writeJsonResponse(w, http.StatusOK, statuses)
+}
+
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJsonResponse(w, http.StatusBadRequest, &errorResponse{Error: "invalid job id"})
+		return
+	}
+	job := s.queue.Job(id)
+	if job == nil {
+		writeJsonResponse(w, http.StatusNotFound, &errorResponse{Error: "job not found"})
+		return
+	}
+	writeJsonResponse(w, http.StatusOK, job.Status())
+}
+
+// renderRequest reads uploaded image and render options
+func (s *server) renderRequest(w http.ResponseWriter, r *http.Request) (*renderedImage, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxUploadSize)
+
+	var img image.Image
+	var err error
+
+	//raw body is not a form, parameters are taken only from query
+	parameterValues := r.URL.Query()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(serveMaxUploadSize); err != nil {
+			return nil, fmt.Errorf("unable to read form: %w", err)
+		}
+		file, _, fileErr := r.FormFile("image")
+		if fileErr != nil {
+			return nil, fmt.Errorf("unable to read image: %w", fileErr)
+		}
+		defer file.Close()
+		img, err = images.Read(file)
+		for name, values := range r.MultipartForm.Value {
+			parameterValues[name] = append(parameterValues[name], values...)
+		}
+	} else {
+		img, err = images.Read(r.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image: %w", err)
+	}
+
+	options := *s.renderOptions
+	parameters := flag.NewFlagSet("request", flag.ContinueOnError)
+	options.bind(parameters)
+
+	for name, values := range parameterValues {
+		if parameters.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+		if err := parameters.Set(name, values[len(values)-1]); err != nil {
+			return nil, fmt.Errorf("invalid parameter %s: %w", name, err)
+		}
+	}
+
+	if !s.display.SupportsMode(options.DeviceMode) {
+		return nil, &eink.UnsupportedModeError{
+			Display:    s.display.Name,
+			DeviceMode: options.DeviceMode,
+			Supported:  s.display.Modes,
+		}
+	}
+
+	return render(img, s.display, &options)
+}
+
+func writeJsonResponse(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := writeJson(w, value); err != nil {
+		log.Warnf("unable to send response: %s", err)
+	}
+}
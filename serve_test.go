@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-eink/eink"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testServer returns API of server printing to simulator
+func testServer(t *testing.T) (*httptest.Server, *eink.Simulator) {
+	t.Helper()
+
+	display := eink.DisplayProfiles[0]
+	simulator := eink.NewSimulator(display)
+
+	printerOptions := defaultPrinterOptions()
+	printerOptions.WriteDataPause = 1
+	printerOptions.ScreenRefreshPause = 1
+	printerOptions.StateFile = "none"
+
+	queue := eink.NewQueue()
+	t.Cleanup(queue.Close)
+
+	s := &server{
+		device:         "simulator",
+		display:        display,
+		transport:      simulator,
+		renderOptions:  defaultRenderOptions(),
+		printerOptions: printerOptions,
+		queue:          queue,
+	}
+
+	api := httptest.NewServer(s.handler())
+	t.Cleanup(api.Close)
+	return api, simulator
+}
+
+// testPNG returns encoded image with red and black halves
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 80, 48))
+	for y := range 48 {
+		for x := range 80 {
+			if x < 40 {
+				img.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{A: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeJson(t *testing.T, response *http.Response, value any) {
+	t.Helper()
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+}
+
+func TestServeDisplay(t *testing.T) {
+	api, _ := testServer(t)
+
+	response, err := http.Get(api.URL + "/api/display")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var display displayResponse
+	decodeJson(t, response, &display)
+
+	if display.Name != eink.DefaultDisplay || display.Width != eink.ImageWidth || display.Height != eink.ImageHeight {
+		t.Errorf("display %+v", display)
+	}
+}
+
+func TestServePreview(t *testing.T) {
+	api, _ := testServer(t)
+
+	response, err := http.Post(api.URL+"/api/preview?device-mode=bwr&image-enlarge=true&image-blend-mode=RBY", "image/png", bytes.NewReader(testPNG(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status %s", response.Status)
+	}
+	preview, err := png.Decode(response.Body)
+	if err != nil {
+		t.Fatalf("unable to decode preview: %s", err)
+	}
+	if preview.Bounds().Dx() != eink.ImageWidth || preview.Bounds().Dy() != eink.ImageHeight {
+		t.Errorf("preview size %v", preview.Bounds())
+	}
+	if r, g, b, _ := preview.At(100, 240).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("preview pixel is %v, expected red", preview.At(100, 240))
+	}
+}
+
+func TestServeInvalidParameter(t *testing.T) {
+	api, _ := testServer(t)
+
+	for _, query := range []string{"?dithering=none", "?device-mode=rgb", "?image-dithering-threshold=dark"} {
+		response, err := http.Post(api.URL+"/api/preview"+query, "image/png", bytes.NewReader(testPNG(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var errResponse errorResponse
+		decodeJson(t, response, &errResponse)
+
+		if response.StatusCode != http.StatusBadRequest || len(errResponse.Error) == 0 {
+			t.Errorf("%s: status %s, error %q", query, response.Status, errResponse.Error)
+		}
+	}
+}
+
+func TestServePrint(t *testing.T) {
+	api, simulator := testServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("image", "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(testPNG(t))
+	form.WriteField("device-mode", eink.DeviceModeBWR)
+	form.Close()
+
+	response, err := http.Post(api.URL+"/api/print", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusAccepted {
+		t.Fatalf("status %s", response.Status)
+	}
+	var status eink.JobStatus
+	decodeJson(t, response, &status)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for status.State != eink.JobDone {
+		if status.State == eink.JobFailed || time.Now().After(deadline) {
+			t.Fatalf("job %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		response, err := http.Get(api.URL + "/api/jobs/" + strconv.FormatInt(status.ID, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decodeJson(t, response, &status)
+	}
+
+	if status.DeviceMode != eink.DeviceModeBWR {
+		t.Errorf("job device mode %s", status.DeviceMode)
+	}
+	if simulator.Frame() == nil {
+		t.Error("frame is not received")
+	}
+}